@@ -0,0 +1,162 @@
+package proxygun
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// AdminHandler returns an http.Handler to inspect and steer a running instance.
+// It has no authentication of its own; mount it on a private listener or wrap
+// it with the caller's auth middleware.
+//
+//	GET  /stats                     pool statistics
+//	GET  /proxies?segment=main      pooled proxies with stats (main, free, bad; all when omitted)
+//	POST /proxies                   add a proxy: {"proxy": "socks5://1.2.3.4:1080", "validate": true}
+//	POST /proxies/ban               move a proxy to the bad pool: {"proxy": "1.2.3.4:8080"}
+//	POST /proxies/unban             return a bad proxy to the pool: {"proxy": "1.2.3.4:8080"}
+//	POST /refresh                   scrape every provider right away, ignoring schedules
+//	GET  /providers                 providers and their paused state
+//	POST /providers/{name}/pause    stop scraping a provider
+//	POST /providers/{name}/resume   resume scraping a provider
+//	POST /drain                     empty the main and free pools
+func (rt *ProxyRoundTripper) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats", rt.adminStats)
+	mux.HandleFunc("GET /proxies", rt.adminListProxies)
+	mux.HandleFunc("POST /proxies", rt.adminAddProxy)
+	mux.HandleFunc("POST /proxies/ban", rt.adminBanProxy)
+	mux.HandleFunc("POST /proxies/unban", rt.adminUnbanProxy)
+	mux.HandleFunc("POST /refresh", rt.adminRefresh)
+	mux.HandleFunc("GET /providers", rt.adminListProviders)
+	mux.HandleFunc("POST /providers/{name}/pause", rt.adminSetProviderPaused(true))
+	mux.HandleFunc("POST /providers/{name}/resume", rt.adminSetProviderPaused(false))
+	mux.HandleFunc("POST /drain", rt.adminDrain)
+	return mux
+}
+
+// adminProxyRequest is the body of the proxy management endpoints
+type adminProxyRequest struct {
+	Proxy    string `json:"proxy"`
+	Validate bool   `json:"validate"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func readProxyRequest(r *http.Request) (*adminProxyRequest, *proxy.Proxy, error) {
+	var req adminProxyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, nil, err
+	}
+	p, err := proxy.Parse(req.Proxy)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &req, p, nil
+}
+
+func (rt *ProxyRoundTripper) adminStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, rt.Stats())
+}
+
+func (rt *ProxyRoundTripper) adminListProxies(w http.ResponseWriter, r *http.Request) {
+	segment := r.URL.Query().Get("segment")
+	switch segment {
+	case "", pool.SegmentMain, pool.SegmentFree, pool.SegmentBad:
+	default:
+		writeJSONError(w, http.StatusBadRequest, fmt.Errorf("unknown segment %q", segment))
+		return
+	}
+
+	entries := make([]pool.Entry, 0)
+	for _, entry := range rt.pool.Snapshot().Entries {
+		if segment == "" || entry.Segment == segment {
+			entries = append(entries, entry)
+		}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+func (rt *ProxyRoundTripper) adminAddProxy(w http.ResponseWriter, r *http.Request) {
+	req, p, err := readProxyRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	p.Source = "admin"
+	p.DiscoveredAt = time.Now()
+
+	// Validation is bounded by the request, a client that gives up aborts it
+	var added bool
+	if req.Validate {
+		added = len(rt.addCandidates(r.Context(), []*proxy.Proxy{p}, "admin")) > 0
+	} else {
+		added = rt.admitCandidate(p) && rt.pool.Add(p)
+	}
+	rt.cfg().Logger.Info().Msgf("Admin add of proxy %s: added=%t", p.String(), added)
+	writeJSON(w, http.StatusOK, map[string]bool{"added": added})
+}
+
+func (rt *ProxyRoundTripper) adminBanProxy(w http.ResponseWriter, r *http.Request) {
+	_, p, err := readProxyRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	rt.pool.Ban(p)
+	rt.cfg().Logger.Info().Msgf("Admin banned proxy %s", p.String())
+	writeJSON(w, http.StatusOK, map[string]bool{"banned": true})
+}
+
+func (rt *ProxyRoundTripper) adminUnbanProxy(w http.ResponseWriter, r *http.Request) {
+	_, p, err := readProxyRequest(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	unbanned := rt.pool.Unban(p)
+	rt.cfg().Logger.Info().Msgf("Admin unban of proxy %s: unbanned=%t", p.String(), unbanned)
+	writeJSON(w, http.StatusOK, map[string]bool{"unbanned": unbanned})
+}
+
+func (rt *ProxyRoundTripper) adminRefresh(w http.ResponseWriter, r *http.Request) {
+	rt.Refresh()
+	writeJSON(w, http.StatusAccepted, map[string]bool{"refresh_scheduled": true})
+}
+
+func (rt *ProxyRoundTripper) adminListProviders(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, rt.parser.Providers())
+}
+
+func (rt *ProxyRoundTripper) adminSetProviderPaused(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if err := rt.parser.SetPaused(name, paused); err != nil {
+			writeJSONError(w, http.StatusNotFound, err)
+			return
+		}
+		rt.cfg().Logger.Info().Msgf("Admin set provider %s paused=%t", name, paused)
+		writeJSON(w, http.StatusOK, map[string]bool{"paused": paused})
+	}
+}
+
+func (rt *ProxyRoundTripper) adminDrain(w http.ResponseWriter, r *http.Request) {
+	drained := rt.pool.Drain()
+	rt.cfg().Logger.Info().Msgf("Admin drained %d proxies from the pool", drained)
+	writeJSON(w, http.StatusOK, map[string]int{"drained": drained})
+}
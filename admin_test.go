@@ -0,0 +1,96 @@
+package proxygun
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/pool"
+)
+
+func TestAdminHandler(t *testing.T) {
+	config := DefaultConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10), ctx: ctx, cancel: cancel}
+	rt.config.Store(config)
+	rt.validator.Store(newValidator(config))
+	handler := rt.AdminHandler()
+
+	call := func(method, target, body string) (int, map[string]any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		var out map[string]any
+		json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out
+	}
+
+	if code, out := call("POST", "/proxies", `{"proxy": "socks5://10.0.0.1:1080"}`); code != http.StatusOK || out["added"] != true {
+		t.Fatalf("add: %d %v", code, out)
+	}
+	if code, out := call("POST", "/proxies", `{"proxy": "ftp://10.0.0.1:21"}`); code != http.StatusBadRequest || out["error"] == nil {
+		t.Errorf("add of an invalid proxy: %d %v", code, out)
+	}
+	if code, _ := call("POST", "/proxies/ban", `{"proxy": "socks5://10.0.0.1:1080"}`); code != http.StatusOK || rt.pool.BadSize() != 1 {
+		t.Fatalf("ban: %d, bad %d", code, rt.pool.BadSize())
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/proxies?segment=bad", nil))
+	var entries []pool.Entry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil || len(entries) != 1 || entries[0].Source != "admin" {
+		t.Errorf("bad segment listed %s", w.Body)
+	}
+	if code, _ := call("GET", "/proxies?segment=nope", ""); code != http.StatusBadRequest {
+		t.Errorf("unknown segment answered %d", code)
+	}
+
+	if code, out := call("POST", "/proxies/unban", `{"proxy": "socks5://10.0.0.1:1080"}`); code != http.StatusOK || out["unbanned"] != true {
+		t.Fatalf("unban: %d %v", code, out)
+	}
+	if code, out := call("POST", "/drain", ""); code != http.StatusOK || out["drained"] != float64(1) {
+		t.Errorf("drain: %d %v", code, out)
+	}
+}
+
+func TestAdminAddValidateCancel(t *testing.T) {
+	// An HTTP proxy that never answers the validation request
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	config := DefaultConfig()
+	config.ValidationURL = "http://check.example/"
+	config.ValidationTimeout = 10 * time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10), ctx: ctx, cancel: cancel}
+	rt.config.Store(config)
+	rt.validator.Store(newValidator(config))
+
+	reqCtx, reqCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer reqCancel()
+	body := `{"proxy": "` + upstream.Listener.Addr().String() + `", "validate": true}`
+	req := httptest.NewRequest("POST", "/proxies", strings.NewReader(body)).WithContext(reqCtx)
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	rt.AdminHandler().ServeHTTP(w, req)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("validation ran %s after the request was cancelled", elapsed)
+	}
+	if rt.pool.Size() != 0 || !strings.Contains(w.Body.String(), `"added":false`) {
+		t.Errorf("answered %s with %d pooled proxies", w.Body, rt.pool.Size())
+	}
+}
@@ -1,9 +1,19 @@
 package proxygun
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/aredoff/proxygun/internal/dialer"
+	"github.com/aredoff/proxygun/internal/geoip"
 	"github.com/aredoff/proxygun/internal/parser"
 	"github.com/aredoff/proxygun/internal/pool"
 	"github.com/aredoff/proxygun/internal/proxy"
@@ -11,11 +21,29 @@ import (
 )
 
 type ProxyRoundTripper struct {
-	config    *Config
+	config    atomic.Pointer[Config]
 	pool      *pool.Pool
 	parser    *parser.MultiParser
-	validator *validator.Validator
-	stopCh    chan struct{}
+	validator atomic.Pointer[validator.Validator]
+	geo       atomic.Pointer[geoip.DB]
+	routes    atomic.Pointer[router]
+	pools     atomic.Pointer[map[string]*ProxyRoundTripper]
+	dialer    atomic.Pointer[dialer.Dialer]
+	refreshCh chan struct{}
+	topUpCh   chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	// Connections that bypassed the proxies
+	directConnections atomic.Int64
+
+	// Serializes Reload calls
+	reloadMu sync.Mutex
+
+	// Optional background workers currently running, guarded by reloadMu
+	stateSaving     bool
+	healthChecking  bool
+	contentSampling bool
 }
 
 func NewProxyRoundTripper(config *Config) *ProxyRoundTripper {
@@ -23,99 +51,501 @@ func NewProxyRoundTripper(config *Config) *ProxyRoundTripper {
 		config = DefaultConfig()
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	rt := &ProxyRoundTripper{
-		config:    config,
-		pool:      pool.NewPool(config.PoolSize),
-		parser:    parser.NewMultiParser(),
-		validator: validator.NewValidator(),
-		stopCh:    make(chan struct{}),
+		pool:      pool.NewPool(config.PoolSize, config.FreePoolSize),
+		parser:    parser.NewMultiParser(buildSources(config)),
+		refreshCh: make(chan struct{}, 1),
+		topUpCh:   make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	rt.config.Store(config)
+	rt.validator.Store(newValidator(config))
+	rt.dialer.Store(newDialer(config))
+	if db, err := openGeoIP(config); err != nil {
+		config.Logger.Error().Msgf("GeoIP enrichment disabled: %v", err)
+	} else {
+		rt.geo.Store(db)
+	}
+	if r, err := newRouter(config); err != nil {
+		config.Logger.Error().Msgf("Routing rules disabled: %v", err)
+	} else {
+		rt.routes.Store(r)
+	}
+	rt.syncPools(config)
+
+	if config.StatePath != "" {
+		rt.loadState()
 	}
 
 	go rt.proxyRefreshWorker()
+	rt.reloadMu.Lock()
+	rt.startWorkers()
+	rt.reloadMu.Unlock()
 	return rt
 }
 
+// cfg returns the config currently in effect
+func (rt *ProxyRoundTripper) cfg() *Config {
+	return rt.config.Load()
+}
+
+// currentValidator returns the validator built from the current config
+func (rt *ProxyRoundTripper) currentValidator() *validator.Validator {
+	return rt.validator.Load()
+}
+
+// startWorkers starts the optional background workers enabled by the current
+// config that are not running yet. Workers stop themselves once disabled.
+// The caller must hold reloadMu.
+func (rt *ProxyRoundTripper) startWorkers() {
+	config := rt.cfg()
+	if stateSaveEnabled(config) && !rt.stateSaving {
+		rt.stateSaving = true
+		go rt.stateSaveWorker(config.StateSaveInterval)
+	}
+	if healthCheckEnabled(config) && !rt.healthChecking {
+		rt.healthChecking = true
+		go rt.healthCheckWorker(config.HealthCheckInterval)
+	}
+	if rt.contentSamplingEnabled(config) && !rt.contentSampling {
+		rt.contentSampling = true
+		go rt.contentSampleWorker(contentSampleInterval(config))
+	}
+}
+
+// keepWorker returns the config a background worker should keep running
+// with, or nil after clearing its running flag when the config disables it or
+// the round tripper is closed. Deciding under reloadMu means a concurrent
+// Reload either keeps the worker running or sees it stopped and starts a new one.
+func (rt *ProxyRoundTripper) keepWorker(running *bool, enabled func(*Config) bool) *Config {
+	rt.reloadMu.Lock()
+	defer rt.reloadMu.Unlock()
+
+	if config := rt.cfg(); rt.ctx.Err() == nil && enabled(config) {
+		return config
+	}
+	*running = false
+	return nil
+}
+
+func stateSaveEnabled(config *Config) bool {
+	return config.StatePath != "" && config.StateSaveInterval > 0
+}
+
+func healthCheckEnabled(config *Config) bool {
+	return config.HealthCheckInterval > 0
+}
+
+func (rt *ProxyRoundTripper) contentSamplingEnabled(config *Config) bool {
+	return rt.currentValidator().ContentCheckEnabled() && config.ContentSampleRate > 0
+}
+
+// Reload applies config to the running instance without losing the pool.
+// Pool sizes, providers, validation settings, retries, good codes, fallback,
+// logger and worker intervals take effect right away; proxies beyond the new
+// PoolSize are demoted to the free pool. Requests already in flight finish
+// with the config they started with.
+func (rt *ProxyRoundTripper) Reload(config *Config) error {
+	if config == nil {
+		return errors.New("nil config")
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	rt.reloadMu.Lock()
+	defer rt.reloadMu.Unlock()
+
+	old := rt.cfg()
+	geoChanged := !slices.Equal(old.GeoIPDatabases, config.GeoIPDatabases) ||
+		!reflect.DeepEqual(geoFilter(old), geoFilter(config))
+	if !slices.Equal(old.GeoIPDatabases, config.GeoIPDatabases) {
+		db, err := openGeoIP(config)
+		if err != nil {
+			return err
+		}
+		rt.geo.Store(db)
+	}
+	routes, err := newRouter(config)
+	if err != nil {
+		return err
+	}
+	rt.routes.Store(routes)
+	rt.syncPools(config)
+	if !reflect.DeepEqual(old.Providers, config.Providers) || !slices.Equal(old.SourceFiles, config.SourceFiles) ||
+		old.ProviderInterval != config.ProviderInterval || old.ProviderTimeout != config.ProviderTimeout ||
+		old.ProviderJitter != config.ProviderJitter {
+		rt.parser.SetSources(buildSources(config))
+	}
+	rt.validator.Store(newValidator(config))
+	rt.dialer.Store(newDialer(config))
+	demoted := rt.pool.Resize(config.PoolSize, config.FreePoolSize)
+	rt.pool.FillFromFree()
+	rt.config.Store(config)
+	rt.startWorkers()
+	if geoChanged {
+		// Lookups may resolve DNS names, so they do not hold up the reload
+		go rt.evictFiltered()
+	}
+
+	config.Logger.Info().Msgf("Configuration reloaded (pool: %d, free: %d, demoted to free pool: %d)",
+		rt.pool.Size(), rt.pool.FreeSize(), demoted)
+	if rt.pool.NeedsProxies() > 0 {
+		rt.Refresh()
+	}
+	return nil
+}
+
+func newValidator(config *Config) *validator.Validator {
+	v := validator.NewValidator()
+	if config.ValidationURL != "" {
+		v.SetTestURL(config.ValidationURL)
+	}
+	if config.ValidationTimeout > 0 {
+		v.SetTimeout(config.ValidationTimeout)
+	}
+	v.SetSpeedTestURL(config.SpeedTestURL)
+	v.SetProxyTLS(config.ProxyTLS)
+	v.SetThresholds(validator.Thresholds{
+		MaxConnectTime:  config.MaxConnectTime,
+		MaxTLSHandshake: config.MaxTLSHandshake,
+		MaxTTFB:         config.MaxTTFB,
+		MinThroughput:   config.MinThroughput,
+	})
+	if config.ContentCheckURL != "" {
+		if config.ContentCheckSHA256 == "" {
+			config.Logger.Error().Msg("ContentCheckURL is set without ContentCheckSHA256, content check disabled")
+		} else {
+			v.SetContentCheck(config.ContentCheckURL, config.ContentCheckSHA256)
+		}
+	}
+	return v
+}
+
+// newDialer creates the dialer tunnelling connections through the proxies
+func newDialer(config *Config) *dialer.Dialer {
+	d := dialer.New(30 * time.Second)
+	d.TLS = config.ProxyTLS
+	return d
+}
+
+// buildSources creates the configured providers followed by the source files,
+// each with its scraping schedule. Nil Providers selects every built-in
+// provider, an empty list none. Invalid providers are logged and skipped;
+// LoadConfig reports them up front.
+func buildSources(config *Config) []parser.Source {
+	schedule := parser.Schedule{
+		Interval: config.ProviderInterval,
+		Timeout:  config.ProviderTimeout,
+		Jitter:   config.ProviderJitter,
+	}
+
+	var sources []parser.Source
+	if config.Providers == nil {
+		for _, p := range parser.DefaultParsers() {
+			sources = append(sources, parser.NewSource(p, schedule))
+		}
+	}
+	for _, pc := range config.Providers {
+		p, err := parser.New(pc.Name, pc.Params)
+		if err != nil {
+			config.Logger.Error().Msgf("Skipping provider: %v", err)
+			continue
+		}
+		s := schedule
+		if pc.Interval > 0 {
+			s.Interval = pc.Interval
+		}
+		if pc.Timeout > 0 {
+			s.Timeout = pc.Timeout
+		}
+		sources = append(sources, parser.NewSource(p, s))
+	}
+	for _, p := range fileProviders(config.SourceFiles) {
+		sources = append(sources, parser.NewSource(p, schedule))
+	}
+	return sources
+}
+
 func (rt *ProxyRoundTripper) proxyRefreshWorker() {
 
-	ticker := time.NewTicker(rt.config.RefreshInterval)
+	ticker := time.NewTicker(rt.cfg().RefreshInterval)
 	defer ticker.Stop()
 
-	rt.refreshProxies()
+	rt.refreshProxies(false)
 
 	for {
 		select {
 		case <-ticker.C:
-			// Move proxies from free pool to main pool if needed
-			beforeSize := rt.pool.Size()
-			rt.pool.FillFromFree()
-			afterSize := rt.pool.Size()
-
-			if afterSize > beforeSize {
-				rt.config.Logger.Info().Msgf("Moved %d proxies from free pool to main pool (%d -> %d)",
-					afterSize-beforeSize, beforeSize, afterSize)
-			}
+			ticker.Reset(rt.cfg().RefreshInterval) // Pick up interval changes from Reload
+			rt.fillPool()
+		case <-rt.topUpCh:
+			rt.fillPool()
+		case <-rt.refreshCh:
+			rt.refreshProxies(true)
+		case <-rt.ctx.Done():
+			return
+		}
+	}
+}
+
+// fillPool moves proxies from the free pool to the main pool and scrapes the
+// providers that are due when that is not enough
+func (rt *ProxyRoundTripper) fillPool() {
+	beforeSize := rt.pool.Size()
+	rt.pool.FillFromFree()
+	afterSize := rt.pool.Size()
 
-			needed := rt.pool.NeedsProxies()
-			if needed > 0 {
-				rt.refreshProxies()
+	if afterSize > beforeSize {
+		rt.cfg().Logger.Info().Msgf("Moved %d proxies from free pool to main pool (%d -> %d)",
+			afterSize-beforeSize, beforeSize, afterSize)
+	}
+
+	if rt.pool.NeedsProxies() > 0 {
+		rt.refreshProxies(false)
+	}
+}
+
+// refreshProxies scrapes the providers that are due, or all of them when
+// force is set, and validates the merged candidates
+func (rt *ProxyRoundTripper) refreshProxies(force bool) {
+	results := rt.parser.ScrapeDue(rt.ctx, force)
+	if len(results) == 0 {
+		return
+	}
+	logger := rt.cfg().Logger
+
+	// Merge results in yield order, the first provider to report a new proxy owns it
+	var found []*proxy.Proxy
+	var names []string
+	owners := make(map[string]string)
+	candidates := make(map[string]int)
+	for _, result := range results {
+		if result.Err != nil {
+			logger.Error().Msgf("Parser error from %s: %v", result.Provider, result.Err)
+		}
+		if len(result.Proxies) == 0 {
+			logger.Info().Msgf("No proxies found from %s", result.Provider)
+			continue
+		}
+		logger.Info().Msgf("Found %d proxies from %s in %s", len(result.Proxies), result.Provider, result.Duration.Round(time.Millisecond))
+
+		names = append(names, result.Provider)
+		for _, p := range result.Proxies {
+			key := p.String()
+			if _, ok := owners[key]; ok {
+				continue
 			}
-		case <-rt.stopCh:
-			return
+			owners[key] = result.Provider
+			found = append(found, p)
 		}
 	}
+
+	if len(found) == 0 {
+		return
+	}
+	source := strings.Join(names, ", ")
+	proxies := rt.newCandidates(found, source)
+	for _, p := range proxies {
+		candidates[owners[p.String()]]++
+	}
+	added := rt.validateCandidates(rt.ctx, proxies, source)
+
+	// Validation stops once the pool is full, the yield is only known when every candidate was checked
+	if rt.pool.Full() {
+		return
+	}
+	validated := make(map[string]int)
+	for _, p := range added {
+		validated[owners[p.String()]]++
+	}
+	for name, n := range candidates {
+		rt.parser.RecordValidated(name, n, validated[name])
+	}
 }
 
-func (rt *ProxyRoundTripper) refreshProxies() {
-	proxies, errs := rt.parser.Parse()
-	providerName := rt.parser.GetCurrentProviderName()
+// addCandidates validates proxies not yet known to the pool and adds those
+// that pass, returning the added proxies. Validation is aborted when ctx is
+// done or the round tripper is closed.
+func (rt *ProxyRoundTripper) addCandidates(ctx context.Context, found []*proxy.Proxy, source string) []*proxy.Proxy {
+	return rt.validateCandidates(ctx, rt.newCandidates(found, source), source)
+}
 
-	if len(errs) > 0 {
-		for _, err := range errs {
-			rt.config.Logger.Error().Msgf("Parser error from %s: %v", providerName, err)
+// newCandidates drops duplicates, proxies already known to the pool and those
+// the GeoIP filters reject, and stamps the rest with their source
+func (rt *ProxyRoundTripper) newCandidates(found []*proxy.Proxy, source string) []*proxy.Proxy {
+	// Skip candidates already known to the pool before dialing them
+	now := time.Now()
+	proxies := make([]*proxy.Proxy, 0, len(found))
+	seen := make(map[string]struct{}, len(found))
+	for _, p := range found {
+		key := p.String()
+		if _, ok := seen[key]; ok || rt.pool.Contains(p) || !rt.admitCandidate(p) {
+			continue
+		}
+		seen[key] = struct{}{}
+		if p.Source == "" {
+			p.Source = source
 		}
+		if p.DiscoveredAt.IsZero() {
+			p.DiscoveredAt = now
+		}
+		proxies = append(proxies, p)
+	}
+	if len(proxies) == 0 {
+		rt.cfg().Logger.Info().Msgf("All %d proxies from %s are already known or filtered out", len(found), source)
 	}
+	return proxies
+}
 
+// validateCandidates validates proxies and adds those that pass to the pool,
+// returning the added proxies
+func (rt *ProxyRoundTripper) validateCandidates(ctx context.Context, proxies []*proxy.Proxy, source string) []*proxy.Proxy {
 	if len(proxies) == 0 {
-		rt.config.Logger.Info().Msgf("No proxies found from %s", providerName)
-		return
+		return nil
+	}
+	config := rt.cfg()
+	config.Logger.Info().Msgf("Found %d new proxies from %s, starting validation...", len(proxies), source)
+
+	workers := config.ValidationWorkers
+	if config.MaxValidationWorkers > 0 && workers > config.MaxValidationWorkers {
+		workers = config.MaxValidationWorkers
 	}
-	rt.config.Logger.Info().Msgf("Found %d proxies from %s, starting validation...", len(proxies), providerName)
+
+	// Validation stops as soon as both pools are full or the round tripper is closed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(rt.ctx, cancel)
+	defer stop()
 
 	// Start validation in background and add proxies as they get validated
-	validChan := make(chan *proxy.Proxy, 100)
+	validChan := make(chan *validator.Result, workers)
 	go func() {
 		defer close(validChan)
-		ValidateProxiesConcurrentStream(rt.validator, proxies, rt.config.ValidationWorkers, validChan)
+		ValidateProxiesConcurrentStream(ctx, rt.currentValidator(), proxies, workers, validChan)
 	}()
 
-	added := 0
-	for validProxy := range validChan {
-		if rt.pool.Add(validProxy) {
-			added++
+	var added []*proxy.Proxy
+	for result := range validChan {
+		// Seed stats with validation measurements so selection can prefer fast proxies
+		proxyWithStats := proxy.NewProxyWithStats(result.Proxy)
+		proxyWithStats.RecordLatency(result.TTFB)
+		proxyWithStats.RecordThroughput(result.Throughput)
+		if rt.pool.AddWithStats(proxyWithStats) {
+			added = append(added, result.Proxy)
+		}
+		if rt.pool.Full() {
+			cancel()
 		}
 	}
 
-	if added > 0 {
-		rt.config.Logger.Info().Msgf("Added %d new proxies to pool from %s (validated %d from %d found)",
-			added, providerName, added, len(proxies))
+	if len(added) > 0 {
+		config.Logger.Info().Msgf("Added %d new proxies to pool from %s (validated %d from %d found)",
+			len(added), source, len(added), len(proxies))
 	} else {
-		rt.config.Logger.Info().Msgf("No valid proxies found from %s (checked %d)", providerName, len(proxies))
+		config.Logger.Info().Msgf("No valid proxies found from %s (checked %d)", source, len(proxies))
 	}
+	return added
 }
 
-// Stats returns current proxy pool statistics
+// contentSampleWorker periodically re-checks a fraction of live proxies for content tampering
+func (rt *ProxyRoundTripper) contentSampleWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Pick up setting changes from Reload
+			config := rt.keepWorker(&rt.contentSampling, rt.contentSamplingEnabled)
+			if config == nil {
+				return
+			}
+			v := rt.currentValidator()
+			ticker.Reset(contentSampleInterval(config))
+
+			for _, p := range rt.pool.Sample(config.ContentSampleRate) {
+				if rt.ctx.Err() != nil {
+					break // The worker stops on the next loop
+				}
+
+				err := v.CheckContent(rt.ctx, p.Proxy)
+				switch {
+				case errors.Is(err, validator.ErrContentMismatch):
+					rt.pool.MoveToBad(p.Proxy)
+					config.Logger.Info().Msgf("Proxy %s tampered with check payload, moving to bad pool", p.Proxy.String())
+				case err != nil:
+					p.RecordFailure()
+				}
+			}
+		case <-rt.ctx.Done():
+			rt.keepWorker(&rt.contentSampling, rt.contentSamplingEnabled)
+			return
+		}
+	}
+}
+
+func contentSampleInterval(config *Config) time.Duration {
+	if config.ContentSampleInterval <= 0 {
+		return 5 * time.Minute
+	}
+	return config.ContentSampleInterval
+}
+
+// topUp asks the refresh worker to fill the pool without forcing a scrape
+func (rt *ProxyRoundTripper) topUp() {
+	select {
+	case rt.topUpCh <- struct{}{}:
+	default: // A top-up is already pending
+	}
+}
+
+// Refresh asks the refresh worker to scrape every provider right away, ignoring their schedules
+func (rt *ProxyRoundTripper) Refresh() {
+	select {
+	case rt.refreshCh <- struct{}{}:
+	default: // A refresh is already pending
+	}
+}
+
+// Stats returns current proxy pool statistics, with those of named pools under "pools"
 func (rt *ProxyRoundTripper) Stats() map[string]interface{} {
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"pool_size":      rt.pool.Size(),
 		"free_pool_size": rt.pool.FreeSize(),
+		"bad_pool_size":  rt.pool.BadSize(),
 		"needs_proxies":  rt.pool.NeedsProxies(),
+		"providers":      rt.parser.Providers(),
+		"sources":        rt.pool.CountBySource(),
+
+		"direct_connections": rt.DirectConnections(),
+	}
+	if pools := rt.namedPools(); len(pools) > 0 {
+		poolStats := make(map[string]interface{}, len(pools))
+		for name, member := range pools {
+			poolStats[name] = member.Stats()
+		}
+		stats["pools"] = poolStats
 	}
+	return stats
 }
 
-// Close stops background workers and cleans up resources
+// Close stops background workers of every pool, saves the pool state if
+// configured and cleans up resources
 func (rt *ProxyRoundTripper) Close() error {
-	close(rt.stopCh)
-	return nil
+	rt.cancel()
+	var errs []error
+	for name, member := range rt.namedPools() {
+		if err := member.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("pool %s: %w", name, err))
+		}
+	}
+	if err := rt.saveState(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
 
 // ProxyClient wraps http.Client with proxy functionality
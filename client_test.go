@@ -0,0 +1,125 @@
+package proxygun
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/parser"
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+	"github.com/rs/zerolog"
+)
+
+func TestAddCandidatesStopsWhenFull(t *testing.T) {
+	// Working HTTP proxies recording whether they were validated
+	const candidates = 8
+	var dialed [candidates]atomic.Bool
+	found := make([]*proxy.Proxy, 0, candidates)
+	for i := range candidates {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dialed[i].Store(true)
+		}))
+		defer server.Close()
+		p, _ := proxy.Parse(server.Listener.Addr().String())
+		found = append(found, p)
+	}
+
+	config := DefaultConfig()
+	config.ValidationURL = "http://check.example/"
+	config.ValidationWorkers = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// An unbounded free pool is full once it holds as many spares as the main pool
+	rt := &ProxyRoundTripper{pool: pool.NewPool(1, 0), ctx: ctx, cancel: cancel}
+	rt.config.Store(config)
+	rt.validator.Store(newValidator(config))
+
+	added := rt.addCandidates(ctx, found, "test")
+	if len(added) != 2 || !rt.pool.Full() {
+		t.Fatalf("added %d proxies, want 2 filling the pools", len(added))
+	}
+	validated := 0
+	for i := range dialed {
+		if dialed[i].Load() {
+			validated++
+		}
+	}
+	// One worker may have picked up another candidate before the cancellation
+	if validated > 4 {
+		t.Errorf("validated %d of %d candidates after the pools filled", validated, candidates)
+	}
+}
+
+func TestReloadWorkers(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.ValidationURL = "http://check.example/"
+	config.HealthCheckIdle = 0
+	config.HealthCheckInterval = time.Millisecond
+	config.Logger = zerolog.Nop()
+	rt := &ProxyRoundTripper{
+		pool:      pool.NewPool(10, 10),
+		parser:    parser.NewMultiParser(nil),
+		refreshCh: make(chan struct{}, 1),
+	}
+	rt.ctx, rt.cancel = context.WithCancel(context.Background())
+	defer rt.cancel()
+	rt.config.Store(config)
+	rt.validator.Store(newValidator(config))
+	rt.dialer.Store(newDialer(config))
+	pooled, _ := proxy.Parse(upstream.Listener.Addr().String())
+	rt.pool.Add(pooled)
+
+	// Requests keep running while the health check is switched on and off
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				req, _ := http.NewRequest("GET", "http://example.com/", nil)
+				if resp, err := rt.RoundTrip(req); err == nil {
+					resp.Body.Close()
+				}
+			}
+		}()
+	}
+	for i := range 200 {
+		c := *config
+		if i%2 == 0 {
+			c.HealthCheckInterval = 0
+		}
+		if err := rt.Reload(&c); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+	}
+	if err := rt.Reload(config); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	wg.Wait()
+
+	// The last reload enabled the health check, so a worker must be checking proxies
+	reloaded := time.Now()
+	deadline := reloaded.Add(5 * time.Second)
+	for rt.pool.Find(pooled).StatsSnapshot().LastChecked.Before(reloaded) {
+		if time.Now().After(deadline) {
+			t.Fatal("no health check ran after the last reload")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
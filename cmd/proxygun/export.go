@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/aredoff/proxygun/internal/format"
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8081", "admin API address of a running proxygun serve")
+	formatName := flags.String("format", "url", "output format: plain, url, jsonl, csv, clash, singbox")
+	segments := flags.String("segments", "main,free", "comma-separated pool segments to export: main, free, bad")
+	flags.Parse(args)
+
+	f, err := format.Parse(*formatName)
+	if err != nil {
+		return err
+	}
+	selected := splitList(*segments)
+	for _, segment := range selected {
+		switch segment {
+		case pool.SegmentMain, pool.SegmentFree, pool.SegmentBad:
+		default:
+			return fmt.Errorf("unknown segment %q", segment)
+		}
+	}
+
+	var entries []pool.Entry
+	if err := adminGet(*addr, "/proxies", &entries); err != nil {
+		return err
+	}
+
+	records := make([]format.Record, 0, len(entries))
+	for _, entry := range entries {
+		if !slices.Contains(selected, entry.Segment) {
+			continue
+		}
+		p, err := proxy.Parse(entry.Proxy)
+		if err != nil {
+			continue
+		}
+		p.Metadata = entry.Metadata
+		records = append(records, format.Record{
+			Proxy:   p,
+			Segment: entry.Segment,
+			Stats:   entry.Stats,
+		})
+	}
+
+	return format.Encode(os.Stdout, f, records)
+}
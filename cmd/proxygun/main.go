@@ -0,0 +1,68 @@
+// Command proxygun scrapes, validates and serves free proxies from the command line.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+const usage = `Usage: proxygun <command> [flags]
+
+Commands:
+  scrape    run proxy providers and print candidates
+  validate  validate a proxy list and print results as JSON lines
+  serve     run the local HTTP and SOCKS5 proxy front-ends
+  stats     query the statistics of a running instance
+  export    print the proxies of a running instance in a list format
+
+Run "proxygun <command> -h" for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
+
+	var err error
+	args := os.Args[2:]
+	switch os.Args[1] {
+	case "scrape":
+		err = runScrape(args, logger)
+	case "validate":
+		err = runValidate(args, logger)
+	case "serve":
+		err = runServe(args, logger)
+	case "stats":
+		err = runStats(args)
+	case "export":
+		err = runExport(args)
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "proxygun %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
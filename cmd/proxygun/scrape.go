@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/format"
+	"github.com/aredoff/proxygun/internal/parser"
+	"github.com/aredoff/proxygun/internal/proxy"
+	"github.com/rs/zerolog"
+)
+
+func runScrape(args []string, logger zerolog.Logger) error {
+	flags := flag.NewFlagSet("scrape", flag.ExitOnError)
+	only := flags.String("providers", "", "comma-separated provider names to run (default all)")
+	formatName := flags.String("format", "url", "output format: plain, url, jsonl, csv, clash, singbox")
+	list := flags.Bool("list", false, "list provider names and exit")
+	timeout := flags.Duration("timeout", time.Minute, "time each provider may take, 0 waits indefinitely")
+	flags.Parse(args)
+
+	f, err := format.Parse(*formatName)
+	if err != nil {
+		return err
+	}
+
+	parsers := parser.DefaultParsers()
+	if *list {
+		for _, p := range parsers {
+			fmt.Println(p.Name())
+		}
+		return nil
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range splitList(*only) {
+		selected[strings.ToLower(name)] = true
+	}
+
+	var sources []parser.Source
+	for _, p := range parsers {
+		if len(selected) > 0 && !selected[strings.ToLower(p.Name())] {
+			continue
+		}
+		sources = append(sources, parser.NewSource(p, parser.Schedule{Timeout: *timeout}))
+	}
+
+	// Providers run concurrently, results keep the provider order
+	results := parser.NewRotatingParser(sources).ScrapeDue(context.Background(), true)
+
+	seen := make(map[string]bool)
+	var records []format.Record
+	for _, result := range results {
+		if result.Err != nil {
+			logger.Error().Msgf("Parser error from %s: %v", result.Provider, result.Err)
+			continue
+		}
+		logger.Info().Msgf("Found %d proxies from %s in %s", len(result.Proxies), result.Provider, result.Duration.Round(time.Millisecond))
+
+		for _, px := range result.Proxies {
+			key := px.URL().String()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			records = append(records, format.Record{Proxy: px})
+		}
+	}
+
+	return format.Encode(os.Stdout, f, records)
+}
+
+// readProxies loads a proxy list from path, or from stdin when path is empty or "-"
+func readProxies(path, formatName string) ([]*proxy.Proxy, error) {
+	in := os.Stdin
+	f := format.URL
+	if path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		in = file
+		f = format.Detect(path)
+	}
+
+	if formatName != "" {
+		var err error
+		if f, err = format.Parse(formatName); err != nil {
+			return nil, err
+		}
+	}
+
+	records, err := format.Decode(in, f)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies := make([]*proxy.Proxy, 0, len(records))
+	for _, r := range records {
+		proxies = append(proxies, r.Proxy)
+	}
+	return proxies, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aredoff/proxygun"
+	"github.com/rs/zerolog"
+)
+
+func runServe(args []string, logger zerolog.Logger) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	httpAddr := flags.String("http", "localhost:8080", "HTTP proxy listen address, empty disables")
+	socksAddr := flags.String("socks", "localhost:1080", "SOCKS5 proxy listen address, empty disables")
+	adminAddr := flags.String("admin", "localhost:8081", "admin API listen address, empty disables")
+	configPath := flags.String("config", "", "YAML or JSON config file reloaded on SIGHUP, PROXYGUN_* environment variables override it")
+	poolSize := flags.Int("pool", 50, "proxy pool size")
+	statePath := flags.String("state", "", "file to persist the pool to")
+	sources := flags.String("sources", "", "comma-separated proxy list files used as extra sources")
+	direct := flags.Bool("direct-fallback", false, "connect directly when no proxy works")
+	strict := flags.Bool("strict", false, "never connect directly, only through proxies resolving hostnames remotely")
+	flags.Parse(args)
+
+	// Direct fallback stays off unless the config or the flag enables it
+	loadConfig := func() (*proxygun.Config, error) {
+		config := proxygun.DefaultConfig()
+		config.Logger = logger
+		config.FallbackTransport = nil
+		if err := config.Load(*configPath); err != nil {
+			return nil, err
+		}
+
+		// Flags given explicitly take precedence over the config
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "pool":
+				config.PoolSize = *poolSize
+			case "state":
+				config.StatePath = *statePath
+			case "sources":
+				config.SourceFiles = splitList(*sources)
+			case "direct-fallback":
+				if *direct {
+					config.FallbackTransport = http.DefaultTransport
+				} else {
+					config.FallbackTransport = nil
+				}
+			case "strict":
+				config.StrictNoDirect = *strict
+			}
+		})
+		return config, nil
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	logger = config.Logger
+
+	rt := proxygun.NewProxyRoundTripper(config)
+	defer rt.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 3)
+
+	var httpServer *proxygun.ProxyServer
+	if *httpAddr != "" {
+		httpServer = proxygun.NewProxyServer(rt)
+		go func() {
+			logger.Info().Msgf("HTTP proxy listening on %s", *httpAddr)
+			if err := httpServer.ListenAndServe(*httpAddr); !errors.Is(err, http.ErrServerClosed) {
+				errCh <- err
+			}
+		}()
+	}
+
+	var socksServer *proxygun.SOCKS5Server
+	if *socksAddr != "" {
+		socksServer = proxygun.NewSOCKS5Server(rt)
+		go func() {
+			logger.Info().Msgf("SOCKS5 proxy listening on %s", *socksAddr)
+			if err := socksServer.ListenAndServe(*socksAddr); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+
+	var adminServer *http.Server
+	if *adminAddr != "" {
+		adminServer = &http.Server{Addr: *adminAddr, Handler: rt.AdminHandler(), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			logger.Info().Msgf("Admin API listening on %s", *adminAddr)
+			if err := adminServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errCh <- err
+			}
+		}()
+	}
+
+	// SIGHUP re-reads the config file and environment and applies them in place
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+wait:
+	for {
+		select {
+		case <-hup:
+			config, err := loadConfig()
+			if err == nil {
+				err = rt.Reload(config)
+			}
+			if err != nil {
+				logger.Error().Msgf("Reload failed, keeping the current config: %v", err)
+			}
+		case <-ctx.Done():
+			logger.Info().Msg("Shutting down")
+			break wait
+		case err = <-errCh:
+			break wait
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if httpServer != nil {
+		httpServer.Shutdown(shutdownCtx)
+	}
+	if socksServer != nil {
+		socksServer.Close()
+	}
+	if adminServer != nil {
+		adminServer.Shutdown(shutdownCtx)
+	}
+	return err
+}
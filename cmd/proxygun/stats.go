@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+func runStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8081", "admin API address of a running proxygun serve")
+	flags.Parse(args)
+
+	var stats map[string]interface{}
+	if err := adminGet(*addr, "/stats", &stats); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stats)
+}
+
+// adminGet decodes the JSON response to a GET of path on the admin API at addr
+func adminGet(addr, path string, v interface{}) error {
+	url := addr
+	if !strings.Contains(url, "://") {
+		url = "http://" + url
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(url, "/") + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("admin API returned %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/aredoff/proxygun"
+	"github.com/aredoff/proxygun/internal/proxy"
+	"github.com/aredoff/proxygun/internal/validator"
+	"github.com/rs/zerolog"
+)
+
+// validateResult is the JSON lines output of the validate command
+type validateResult struct {
+	Proxy        string  `json:"proxy"`
+	Valid        bool    `json:"valid"`
+	ConnectMs    int64   `json:"connect_ms,omitempty"`
+	TLSHandshake int64   `json:"tls_handshake_ms,omitempty"`
+	TTFBMs       int64   `json:"ttfb_ms,omitempty"`
+	Throughput   float64 `json:"throughput,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+func runValidate(args []string, logger zerolog.Logger) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	in := flags.String("in", "-", "proxy list file, - for stdin")
+	formatName := flags.String("format", "", "input format (default: detected from extension, url for stdin)")
+	configPath := flags.String("config", "", "YAML or JSON config file with the validation settings, PROXYGUN_* environment variables override it")
+	workers := flags.Int("workers", 0, "number of concurrent validations, 0 uses the max_workers validation setting")
+	detect := flags.Bool("detect", true, "detect proxy type instead of trusting the list")
+	onlyValid := flags.Bool("valid", false, "print only proxies that passed")
+	flags.Parse(args)
+
+	config := proxygun.DefaultConfig()
+	config.Logger = logger
+	if err := config.Load(*configPath); err != nil {
+		return err
+	}
+	if *workers <= 0 {
+		*workers = config.MaxValidationWorkers
+	}
+
+	proxies, err := readProxies(*in, *formatName)
+	if err != nil {
+		return err
+	}
+	logger.Info().Msgf("Validating %d proxies with %d workers", len(proxies), *workers)
+
+	// Interrupting aborts the validations in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	v := newValidator(config)
+	jobs := make(chan *proxy.Proxy)
+	results := make(chan *validator.Result)
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(*workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				if *detect {
+					results <- v.ValidateAndDetectType(ctx, p)
+				} else {
+					results <- v.ValidateProxy(ctx, p)
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for _, p := range proxies {
+			jobs <- p
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	encoder := json.NewEncoder(os.Stdout)
+	valid := 0
+	for r := range results {
+		if r.Valid {
+			valid++
+		} else if *onlyValid {
+			continue
+		}
+
+		out := validateResult{
+			Proxy:        r.Proxy.URL().String(),
+			Valid:        r.Valid,
+			ConnectMs:    r.ConnectTime.Milliseconds(),
+			TLSHandshake: r.TLSHandshake.Milliseconds(),
+			TTFBMs:       r.TTFB.Milliseconds(),
+			Throughput:   r.Throughput,
+		}
+		if r.Err != nil {
+			out.Error = r.Err.Error()
+		}
+		if err := encoder.Encode(out); err != nil {
+			return err
+		}
+	}
+
+	logger.Info().Msgf("%d of %d proxies are valid", valid, len(proxies))
+	return nil
+}
+
+// newValidator creates a validator with the validation settings of config
+func newValidator(config *proxygun.Config) *validator.Validator {
+	v := validator.NewValidator()
+	if config.ValidationURL != "" {
+		v.SetTestURL(config.ValidationURL)
+	}
+	if config.ValidationTimeout > 0 {
+		v.SetTimeout(config.ValidationTimeout)
+	}
+	v.SetSpeedTestURL(config.SpeedTestURL)
+	v.SetProxyTLS(config.ProxyTLS)
+	v.SetThresholds(validator.Thresholds{
+		MaxConnectTime:  config.MaxConnectTime,
+		MaxTLSHandshake: config.MaxTLSHandshake,
+		MaxTTFB:         config.MaxTTFB,
+		MinThroughput:   config.MinThroughput,
+	})
+	if config.ContentCheckURL != "" && config.ContentCheckSHA256 != "" {
+		v.SetContentCheck(config.ContentCheckURL, config.ContentCheckSHA256)
+	}
+	return v
+}
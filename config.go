@@ -1,10 +1,12 @@
 package proxygun
 
 import (
+	"crypto/tls"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/aredoff/proxygun/internal/proxy"
 	"github.com/rs/zerolog"
 )
 
@@ -12,27 +14,154 @@ const (
 	MinimalRequestsToCheckBad = 10
 )
 
+// ProxyType is the protocol spoken by an upstream proxy
+type ProxyType = proxy.Type
+
+const (
+	ProxyHTTP   = proxy.HTTP
+	ProxySOCKS4 = proxy.SOCKS4
+	ProxySOCKS5 = proxy.SOCKS5
+	ProxyHTTPS  = proxy.HTTPS
+)
+
+// Anonymity is the anonymity level a provider claims for a proxy
+type Anonymity = proxy.Anonymity
+
+const (
+	AnonymityUnknown     = proxy.AnonymityUnknown
+	AnonymityTransparent = proxy.Transparent
+	AnonymityAnonymous   = proxy.Anonymous
+	AnonymityElite       = proxy.Elite
+)
+
+// DNSResolution is where destination hostnames are resolved when tunnelling
+// through SOCKS proxies
+type DNSResolution = proxy.Resolution
+
+const (
+	DNSDefault = proxy.ResolveDefault // SOCKS5 and SOCKS4a-capable proxies resolve remotely, other SOCKS4 proxies locally
+	DNSLocal   = proxy.ResolveLocal   // Resolve locally, as socks5:// and socks4:// clients do
+	DNSRemote  = proxy.ResolveRemote  // Send hostnames to the proxy, as socks5h:// and socks4a:// clients do
+)
+
+// ProviderConfig enables a built-in provider by name with optional parameters.
+// Zero Interval and Timeout use Config.ProviderInterval and Config.ProviderTimeout.
+type ProviderConfig struct {
+	Name     string
+	Params   map[string]string
+	Interval time.Duration
+	Timeout  time.Duration
+}
+
 type Config struct {
-	PoolSize          int
-	MaxRetries        int
-	RefreshInterval   time.Duration
-	ValidationWorkers int
-	GoodCodes         []int
-	ErrorsToDie       int
-	FallbackTransport http.RoundTripper
-	Logger            zerolog.Logger
+	PoolSize             int
+	FreePoolSize         int
+	MaxRetries           int
+	RefreshInterval      time.Duration
+	ValidationWorkers    int
+	MaxValidationWorkers int
+	GoodCodes            []int
+	ErrorsToDie          int
+	Providers            []ProviderConfig
+	SourceFiles          []string
+	FallbackTransport    http.RoundTripper
+	Logger               zerolog.Logger
+
+	// Host routing, evaluated at the start of every request. NoProxy entries
+	// (NO_PROXY syntax) go direct; otherwise the first matching rule of Routes
+	// applies, and requests matching none use the pool.
+	NoProxy []string
+	Routes  []RouteRule
+
+	// StrictNoDirect guarantees that requests never leave without a proxy: the
+	// fallback transport is not used, direct connections are refused and only
+	// proxies resolving hostnames remotely are selected. WaitForProxy queues
+	// requests finding no usable proxy for up to that long (0 fails at once).
+	StrictNoDirect bool
+	WaitForProxy   time.Duration
+
+	// Hostname resolution for SOCKS proxies without a resolution of their own
+	// (socks5h:// and socks4a:// URLs ask for remote resolution)
+	SOCKSDNS DNSResolution
+
+	// TLS to https:// proxies: ServerName overrides the SNI (the proxy host by
+	// default), RootCAs trusts a custom CA and Certificates holds an optional
+	// client certificate. Nil verifies proxies against the system roots.
+	ProxyTLS *tls.Config
+
+	// Additional named pools with their own sources, validation and size,
+	// reached through RouteRule.Pools. Their routing settings and fallback
+	// transport are ignored.
+	Pools map[string]*Config
+
+	// Per-provider scraping schedule, providers are scraped concurrently
+	ProviderInterval time.Duration
+	ProviderTimeout  time.Duration
+	ProviderJitter   float64
+
+	// Offline GeoIP/ASN enrichment from .mmdb files and candidate filtering
+	// before validation. Allow lists reject proxies with unknown values.
+	GeoIPDatabases  []string
+	AllowCountries  []string
+	DenyCountries   []string
+	AllowASNs       []uint
+	DenyASNs        []uint
+	DenyDatacenter  bool
+	DenyResidential bool
+
+	// Validation target, empty values keep the validator defaults
+	ValidationURL     string
+	ValidationTimeout time.Duration
+
+	// Validation admission thresholds, zero disables a limit
+	MaxConnectTime  time.Duration
+	MaxTLSHandshake time.Duration
+	MaxTTFB         time.Duration
+	MinThroughput   float64
+	SpeedTestURL    string
+
+	// Background re-validation of pooled proxies
+	HealthCheckInterval time.Duration
+	HealthCheckBatch    int
+	HealthCheckIdle     time.Duration
+	FreePoolMaxAge      time.Duration
+
+	// Pool persistence, empty StatePath disables it
+	StatePath         string
+	StateSaveInterval time.Duration
+
+	// Content tampering detection
+	ContentCheckURL       string
+	ContentCheckSHA256    string
+	ContentSampleRate     float64
+	ContentSampleInterval time.Duration
 }
 
 func DefaultConfig() *Config {
 	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
 	return &Config{
-		PoolSize:          50,
-		MaxRetries:        3,
-		RefreshInterval:   10 * time.Second,
-		ValidationWorkers: 30,
-		GoodCodes:         []int{200, 201, 202, 203, 204, 205, 206, 300, 301, 302, 303, 304, 305, 306, 307, 308},
-		ErrorsToDie:       4,
-		FallbackTransport: http.DefaultTransport,
-		Logger:            logger,
+		PoolSize:             50,
+		FreePoolSize:         100,
+		MaxRetries:           3,
+		RefreshInterval:      10 * time.Second,
+		ValidationWorkers:    30,
+		MaxValidationWorkers: 50,
+		GoodCodes:            []int{200, 201, 202, 203, 204, 205, 206, 300, 301, 302, 303, 304, 305, 306, 307, 308},
+		ErrorsToDie:          4,
+		FallbackTransport:    http.DefaultTransport,
+		Logger:               logger,
+
+		ProviderInterval: 2 * time.Minute,
+		ProviderTimeout:  1 * time.Minute,
+		ProviderJitter:   0.2,
+
+		HealthCheckInterval: 1 * time.Minute,
+		HealthCheckBatch:    10,
+		HealthCheckIdle:     5 * time.Minute,
+		FreePoolMaxAge:      30 * time.Minute,
+
+		StateSaveInterval: 5 * time.Minute,
+
+		ContentSampleInterval: 5 * time.Minute,
 	}
 }
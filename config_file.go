@@ -0,0 +1,550 @@
+package proxygun
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/parser"
+	"github.com/aredoff/proxygun/internal/proxy"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables read by LoadConfig
+const EnvPrefix = "PROXYGUN"
+
+// duration reads time.Duration values written as "10s" or "5m"
+type duration time.Duration
+
+func (d *duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(strings.TrimSpace(string(text)))
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// fileConfig is the file and environment representation of Config. Pointer
+// fields tell settings that were left out apart from zero values.
+type fileConfig struct {
+	PoolSize        *int           `yaml:"pool_size" json:"pool_size"`
+	FreePoolSize    *int           `yaml:"free_pool_size" json:"free_pool_size"`
+	MaxRetries      *int           `yaml:"max_retries" json:"max_retries"`
+	RefreshInterval *duration      `yaml:"refresh_interval" json:"refresh_interval"`
+	GoodCodes       []int          `yaml:"good_codes" json:"good_codes"`
+	ErrorsToDie     *int           `yaml:"errors_to_die" json:"errors_to_die"`
+	Fallback        *string        `yaml:"fallback" json:"fallback"`
+	StrictNoDirect  *bool          `yaml:"strict_no_direct" json:"strict_no_direct"`
+	WaitForProxy    *duration      `yaml:"wait_for_proxy" json:"wait_for_proxy"`
+	SOCKSDNS        *DNSResolution `yaml:"socks_dns" json:"socks_dns"`
+	ProxyTLS        fileProxyTLS   `yaml:"proxy_tls" json:"proxy_tls"`
+	LogLevel        *string        `yaml:"log_level" json:"log_level"`
+	Providers       []fileProvider `yaml:"providers" json:"providers"`
+	SourceFiles     []string       `yaml:"source_files" json:"source_files"`
+	NoProxy         []string       `yaml:"no_proxy" json:"no_proxy"`
+	Routes          []fileRoute    `yaml:"routes" json:"routes"`
+
+	// Named pools inherit the settings above except state, routing and pools
+	Pools map[string]*fileConfig `yaml:"pools" json:"pools"`
+
+	ProviderInterval *duration `yaml:"provider_interval" json:"provider_interval"`
+	ProviderTimeout  *duration `yaml:"provider_timeout" json:"provider_timeout"`
+	ProviderJitter   *float64  `yaml:"provider_jitter" json:"provider_jitter"`
+
+	Validation struct {
+		Workers         *int      `yaml:"workers" json:"workers"`
+		MaxWorkers      *int      `yaml:"max_workers" json:"max_workers"`
+		URL             *string   `yaml:"url" json:"url"`
+		Timeout         *duration `yaml:"timeout" json:"timeout"`
+		MaxConnectTime  *duration `yaml:"max_connect_time" json:"max_connect_time"`
+		MaxTLSHandshake *duration `yaml:"max_tls_handshake" json:"max_tls_handshake"`
+		MaxTTFB         *duration `yaml:"max_ttfb" json:"max_ttfb"`
+		MinThroughput   *float64  `yaml:"min_throughput" json:"min_throughput"`
+		SpeedTestURL    *string   `yaml:"speed_test_url" json:"speed_test_url"`
+	} `yaml:"validation" json:"validation"`
+
+	ContentCheck struct {
+		URL            *string   `yaml:"url" json:"url"`
+		SHA256         *string   `yaml:"sha256" json:"sha256"`
+		SampleRate     *float64  `yaml:"sample_rate" json:"sample_rate"`
+		SampleInterval *duration `yaml:"sample_interval" json:"sample_interval"`
+	} `yaml:"content_check" json:"content_check"`
+
+	HealthCheck struct {
+		Interval       *duration `yaml:"interval" json:"interval"`
+		Batch          *int      `yaml:"batch" json:"batch"`
+		Idle           *duration `yaml:"idle" json:"idle"`
+		FreePoolMaxAge *duration `yaml:"free_pool_max_age" json:"free_pool_max_age"`
+	} `yaml:"health_check" json:"health_check"`
+
+	GeoIP struct {
+		Databases       []string `yaml:"databases" json:"databases"`
+		AllowCountries  []string `yaml:"allow_countries" json:"allow_countries"`
+		DenyCountries   []string `yaml:"deny_countries" json:"deny_countries"`
+		AllowASNs       []uint   `yaml:"allow_asns" json:"allow_asns"`
+		DenyASNs        []uint   `yaml:"deny_asns" json:"deny_asns"`
+		DenyDatacenter  *bool    `yaml:"deny_datacenter" json:"deny_datacenter"`
+		DenyResidential *bool    `yaml:"deny_residential" json:"deny_residential"`
+	} `yaml:"geoip" json:"geoip"`
+
+	State struct {
+		Path         *string   `yaml:"path" json:"path"`
+		SaveInterval *duration `yaml:"save_interval" json:"save_interval"`
+	} `yaml:"state" json:"state"`
+}
+
+// fileProvider is the file representation of ProviderConfig
+type fileProvider struct {
+	Name     string            `yaml:"name" json:"name"`
+	Params   map[string]string `yaml:"params" json:"params"`
+	Interval duration          `yaml:"interval" json:"interval"`
+	Timeout  duration          `yaml:"timeout" json:"timeout"`
+}
+
+// fileProxyTLS is the file representation of Config.ProxyTLS
+type fileProxyTLS struct {
+	ServerName         *string `yaml:"server_name" json:"server_name"`
+	CAFile             *string `yaml:"ca_file" json:"ca_file"`
+	CertFile           *string `yaml:"cert_file" json:"cert_file"`
+	KeyFile            *string `yaml:"key_file" json:"key_file"`
+	InsecureSkipVerify *bool   `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+}
+
+// config returns base with the settings of ft applied, loading the CA and
+// client certificate files. Empty file paths go back to the system roots and
+// no client certificate.
+func (ft *fileProxyTLS) config(base *tls.Config) (*tls.Config, error) {
+	if *ft == (fileProxyTLS{}) {
+		return base, nil
+	}
+	c := base.Clone()
+	if c == nil {
+		c = &tls.Config{}
+	}
+	if ft.ServerName != nil {
+		c.ServerName = *ft.ServerName
+	}
+	if ft.InsecureSkipVerify != nil {
+		c.InsecureSkipVerify = *ft.InsecureSkipVerify
+	}
+
+	if ft.CAFile != nil {
+		c.RootCAs = nil
+		if *ft.CAFile != "" {
+			data, err := os.ReadFile(*ft.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("proxy_tls.ca_file: %w", err)
+			}
+			c.RootCAs = x509.NewCertPool()
+			if !c.RootCAs.AppendCertsFromPEM(data) {
+				return nil, fmt.Errorf("proxy_tls.ca_file: no PEM certificates in %s", *ft.CAFile)
+			}
+		}
+	}
+
+	if ft.CertFile != nil || ft.KeyFile != nil {
+		if ft.CertFile == nil || ft.KeyFile == nil {
+			return nil, errors.New("proxy_tls: cert_file and key_file must be set together")
+		}
+		c.Certificates = nil
+		if *ft.CertFile != "" || *ft.KeyFile != "" {
+			cert, err := tls.LoadX509KeyPair(*ft.CertFile, *ft.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("proxy_tls: %w", err)
+			}
+			c.Certificates = []tls.Certificate{cert}
+		}
+	}
+	return c, nil
+}
+
+// fileRoute is the file representation of RouteRule
+type fileRoute struct {
+	Hosts       []string    `yaml:"hosts" json:"hosts"`
+	CIDRs       []string    `yaml:"cidrs" json:"cidrs"`
+	Schemes     []string    `yaml:"schemes" json:"schemes"`
+	Ports       []int       `yaml:"ports" json:"ports"`
+	Action      RouteAction `yaml:"action" json:"action"`
+	Pools       []string    `yaml:"pools" json:"pools"`
+	Constraints struct {
+		Types        []string  `yaml:"types" json:"types"`
+		Countries    []string  `yaml:"countries" json:"countries"`
+		MinAnonymity Anonymity `yaml:"min_anonymity" json:"min_anonymity"`
+		MaxLatency   duration  `yaml:"max_latency" json:"max_latency"`
+		Exclude      []string  `yaml:"exclude" json:"exclude"`
+		RequireHTTPS bool      `yaml:"require_https" json:"require_https"`
+	} `yaml:"constraints" json:"constraints"`
+}
+
+func (fr *fileRoute) rule() (RouteRule, error) {
+	fc := fr.Constraints
+	rule := RouteRule{
+		Hosts:   fr.Hosts,
+		CIDRs:   fr.CIDRs,
+		Schemes: fr.Schemes,
+		Ports:   fr.Ports,
+		Action:  fr.Action,
+		Pools:   fr.Pools,
+		Constraints: Constraints{
+			Countries:    fc.Countries,
+			MinAnonymity: fc.MinAnonymity,
+			MaxLatency:   time.Duration(fc.MaxLatency),
+			Exclude:      fc.Exclude,
+			RequireHTTPS: fc.RequireHTTPS,
+		},
+	}
+	for _, name := range fc.Types {
+		proxyType, err := proxy.ParseType(name)
+		if err != nil {
+			return rule, fmt.Errorf("routes: %w", err)
+		}
+		rule.Constraints.Types = append(rule.Constraints.Types, proxyType)
+	}
+	return rule, nil
+}
+
+// LoadConfig builds a Config from DefaultConfig, the YAML or JSON file at path
+// (skipped when empty) and PROXYGUN_* environment variables, in that order,
+// and validates the result. Nested settings map to variables by joining their
+// keys, e.g. validation.max_ttfb becomes PROXYGUN_VALIDATION_MAX_TTFB. Lists
+// are comma-separated and PROXYGUN_PROVIDERS takes provider names.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	if err := config.Load(path); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Load applies the file at path and the environment on top of c and validates
+// the result. Settings missing from both keep their current values.
+func (c *Config) Load(path string) error {
+	var fc fileConfig
+	if path != "" {
+		if err := readConfigFile(path, &fc); err != nil {
+			return err
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(&fc).Elem(), EnvPrefix, os.LookupEnv); err != nil {
+		return err
+	}
+	if err := fc.apply(c); err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+func readConfigFile(path string, fc *fileConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(fc)
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err = decoder.Decode(fc); errors.Is(err, io.EOF) {
+			err = nil // Empty file
+		}
+	default:
+		return fmt.Errorf("config %s: unsupported extension, use .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyEnv overrides fields of the struct v with environment variables named
+// after the prefix and the field keys
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		name := prefix + "_" + strings.ToUpper(key)
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnv(v.Field(i), name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(v.Field(i), value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setEnvValue(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case []fileProvider:
+		var providers []fileProvider
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				providers = append(providers, fileProvider{Name: name})
+			}
+		}
+		field.Set(reflect.ValueOf(providers))
+		return nil
+	case *string:
+		field.Set(reflect.ValueOf(&value))
+		return nil
+	}
+
+	if field.Kind() == reflect.Slice && !strings.HasPrefix(strings.TrimSpace(value), "[") {
+		value = "[" + value + "]"
+	}
+	return yaml.Unmarshal([]byte(value), field.Addr().Interface())
+}
+
+func (fc *fileConfig) apply(c *Config) error {
+	setInt := func(dst *int, src *int) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setDuration := func(dst *time.Duration, src *duration) {
+		if src != nil {
+			*dst = time.Duration(*src)
+		}
+	}
+	setString := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setFloat := func(dst *float64, src *float64) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setBool := func(dst *bool, src *bool) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+
+	setInt(&c.PoolSize, fc.PoolSize)
+	setInt(&c.FreePoolSize, fc.FreePoolSize)
+	setInt(&c.MaxRetries, fc.MaxRetries)
+	setDuration(&c.RefreshInterval, fc.RefreshInterval)
+	setInt(&c.ErrorsToDie, fc.ErrorsToDie)
+	if fc.GoodCodes != nil {
+		c.GoodCodes = fc.GoodCodes
+	}
+	if fc.Providers != nil {
+		c.Providers = make([]ProviderConfig, 0, len(fc.Providers))
+		for _, fp := range fc.Providers {
+			c.Providers = append(c.Providers, ProviderConfig{
+				Name:     fp.Name,
+				Params:   fp.Params,
+				Interval: time.Duration(fp.Interval),
+				Timeout:  time.Duration(fp.Timeout),
+			})
+		}
+	}
+	setDuration(&c.ProviderInterval, fc.ProviderInterval)
+	setDuration(&c.ProviderTimeout, fc.ProviderTimeout)
+	setFloat(&c.ProviderJitter, fc.ProviderJitter)
+	if fc.SourceFiles != nil {
+		c.SourceFiles = fc.SourceFiles
+	}
+
+	if fc.NoProxy != nil {
+		c.NoProxy = fc.NoProxy
+	}
+	if fc.Routes != nil {
+		c.Routes = make([]RouteRule, 0, len(fc.Routes))
+		for _, fr := range fc.Routes {
+			rule, err := fr.rule()
+			if err != nil {
+				return err
+			}
+			c.Routes = append(c.Routes, rule)
+		}
+	}
+
+	if fc.Fallback != nil {
+		switch strings.ToLower(*fc.Fallback) {
+		case "direct":
+			c.FallbackTransport = http.DefaultTransport
+		case "none":
+			c.FallbackTransport = nil
+		default:
+			return fmt.Errorf("fallback must be \"direct\" or \"none\", got %q", *fc.Fallback)
+		}
+	}
+
+	setBool(&c.StrictNoDirect, fc.StrictNoDirect)
+	setDuration(&c.WaitForProxy, fc.WaitForProxy)
+	if fc.SOCKSDNS != nil {
+		c.SOCKSDNS = *fc.SOCKSDNS
+	}
+	proxyTLS, err := fc.ProxyTLS.config(c.ProxyTLS)
+	if err != nil {
+		return err
+	}
+	c.ProxyTLS = proxyTLS
+
+	if fc.LogLevel != nil {
+		level, err := zerolog.ParseLevel(strings.ToLower(*fc.LogLevel))
+		if err != nil {
+			return fmt.Errorf("log_level: %w", err)
+		}
+		c.Logger = c.Logger.Level(level)
+	}
+
+	v := fc.Validation
+	setInt(&c.ValidationWorkers, v.Workers)
+	setInt(&c.MaxValidationWorkers, v.MaxWorkers)
+	setString(&c.ValidationURL, v.URL)
+	setDuration(&c.ValidationTimeout, v.Timeout)
+	setDuration(&c.MaxConnectTime, v.MaxConnectTime)
+	setDuration(&c.MaxTLSHandshake, v.MaxTLSHandshake)
+	setDuration(&c.MaxTTFB, v.MaxTTFB)
+	setFloat(&c.MinThroughput, v.MinThroughput)
+	setString(&c.SpeedTestURL, v.SpeedTestURL)
+
+	cc := fc.ContentCheck
+	setString(&c.ContentCheckURL, cc.URL)
+	setString(&c.ContentCheckSHA256, cc.SHA256)
+	setFloat(&c.ContentSampleRate, cc.SampleRate)
+	setDuration(&c.ContentSampleInterval, cc.SampleInterval)
+
+	hc := fc.HealthCheck
+	setDuration(&c.HealthCheckInterval, hc.Interval)
+	setInt(&c.HealthCheckBatch, hc.Batch)
+	setDuration(&c.HealthCheckIdle, hc.Idle)
+	setDuration(&c.FreePoolMaxAge, hc.FreePoolMaxAge)
+
+	geo := fc.GeoIP
+	if geo.Databases != nil {
+		c.GeoIPDatabases = geo.Databases
+	}
+	if geo.AllowCountries != nil {
+		c.AllowCountries = geo.AllowCountries
+	}
+	if geo.DenyCountries != nil {
+		c.DenyCountries = geo.DenyCountries
+	}
+	if geo.AllowASNs != nil {
+		c.AllowASNs = geo.AllowASNs
+	}
+	if geo.DenyASNs != nil {
+		c.DenyASNs = geo.DenyASNs
+	}
+	setBool(&c.DenyDatacenter, geo.DenyDatacenter)
+	setBool(&c.DenyResidential, geo.DenyResidential)
+
+	setString(&c.StatePath, fc.State.Path)
+	setDuration(&c.StateSaveInterval, fc.State.SaveInterval)
+
+	if fc.Pools != nil {
+		c.Pools = make(map[string]*Config, len(fc.Pools))
+		for name, fp := range fc.Pools {
+			pc := *c
+			pc.Pools, pc.Routes, pc.NoProxy = nil, nil, nil
+			pc.StatePath = ""
+			if fp != nil {
+				if err := fp.apply(&pc); err != nil {
+					return fmt.Errorf("pools.%s: %w", name, err)
+				}
+			}
+			c.Pools[name] = &pc
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration and reports every invalid setting
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.PoolSize > 0, "pool_size must be positive, got %d", c.PoolSize)
+	check(c.FreePoolSize >= 0, "free_pool_size must not be negative, got %d", c.FreePoolSize)
+	check(c.MaxRetries >= 0, "max_retries must not be negative, got %d", c.MaxRetries)
+	check(c.RefreshInterval > 0, "refresh_interval must be positive, got %s", c.RefreshInterval)
+	check(c.ValidationWorkers > 0, "validation.workers must be positive, got %d", c.ValidationWorkers)
+	check(c.MaxValidationWorkers >= 0, "validation.max_workers must not be negative, got %d", c.MaxValidationWorkers)
+	check(c.ValidationTimeout >= 0, "validation.timeout must not be negative, got %s", c.ValidationTimeout)
+	check(c.MaxConnectTime >= 0 && c.MaxTLSHandshake >= 0 && c.MaxTTFB >= 0 && c.MinThroughput >= 0,
+		"validation thresholds must not be negative")
+	check(len(c.GoodCodes) > 0, "good_codes must not be empty")
+	for _, code := range c.GoodCodes {
+		check(code >= 100 && code <= 599, "good_codes: %d is not an HTTP status code", code)
+	}
+
+	check(c.ProviderInterval > 0, "provider_interval must be positive, got %s", c.ProviderInterval)
+	check(c.ProviderTimeout >= 0, "provider_timeout must not be negative, got %s", c.ProviderTimeout)
+	check(c.ProviderJitter >= 0 && c.ProviderJitter <= 1, "provider_jitter must be between 0 and 1, got %g", c.ProviderJitter)
+	for _, pc := range c.Providers {
+		_, err := parser.New(pc.Name, pc.Params)
+		check(err == nil, "providers: %v", err)
+		check(pc.Interval >= 0 && pc.Timeout >= 0, "providers: %s interval and timeout must not be negative", pc.Name)
+	}
+	for _, path := range c.SourceFiles {
+		_, err := os.Stat(path)
+		check(err == nil, "source_files: %v", err)
+	}
+
+	for _, path := range c.GeoIPDatabases {
+		_, err := os.Stat(path)
+		check(err == nil, "geoip.databases: %v", err)
+	}
+	for _, country := range append(slices.Clone(c.AllowCountries), c.DenyCountries...) {
+		check(proxy.NormalizeCountry(country) != "", "geoip: %q is not a two-letter country code", country)
+	}
+	check(len(c.GeoIPDatabases) > 0 || (len(c.AllowASNs) == 0 && len(c.DenyASNs) == 0 && !c.DenyDatacenter && !c.DenyResidential),
+		"geoip: ASN and network type filters need geoip.databases")
+
+	if _, err := newRouter(c); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validatePools(c)...)
+	errs = append(errs, validateStrict(c)...)
+	check(c.WaitForProxy >= 0, "wait_for_proxy must not be negative, got %s", c.WaitForProxy)
+
+	check(c.ContentCheckURL == "" || c.ContentCheckSHA256 != "", "content_check.sha256 is required when content_check.url is set")
+	check(c.ContentSampleRate >= 0 && c.ContentSampleRate <= 1, "content_check.sample_rate must be between 0 and 1, got %g", c.ContentSampleRate)
+	check(c.ContentSampleRate == 0 || c.ContentSampleInterval > 0, "content_check.sample_interval must be positive when sampling is enabled")
+
+	check(c.HealthCheckInterval >= 0, "health_check.interval must not be negative, got %s", c.HealthCheckInterval)
+	check(c.HealthCheckBatch >= 0, "health_check.batch must not be negative, got %d", c.HealthCheckBatch)
+	check(c.StatePath == "" || c.StateSaveInterval >= 0, "state.save_interval must not be negative")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package proxygun
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigYAML(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+pool_size: 20
+refresh_interval: 30s
+good_codes: [200, 204]
+fallback: none
+providers:
+  - name: kuaidaili
+    params:
+      pages: "2"
+validation:
+  url: https://example.com/
+  max_ttfb: 2s
+health_check:
+  interval: 0s
+socks_dns: remote
+proxy_tls:
+  server_name: proxy.example.com
+no_proxy: [localhost, 10.0.0.0/8]
+routes:
+  - hosts: ["*.bank.example"]
+    action: pool
+    constraints:
+      types: [socks5]
+      min_anonymity: elite
+  - ports: [25]
+    action: reject
+  - hosts: [.shop.example]
+    pools: [paid, default, direct]
+pools:
+  paid:
+    pool_size: 5
+    source_files: []
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.PoolSize != 20 || config.RefreshInterval != 30*time.Second {
+		t.Errorf("pool settings not loaded: %d %s", config.PoolSize, config.RefreshInterval)
+	}
+	if len(config.GoodCodes) != 2 || config.FallbackTransport != nil {
+		t.Errorf("good codes %v, fallback %v", config.GoodCodes, config.FallbackTransport)
+	}
+	if len(config.Providers) != 1 || config.Providers[0].Params["pages"] != "2" {
+		t.Errorf("providers not loaded: %+v", config.Providers)
+	}
+	if config.ValidationURL != "https://example.com/" || config.MaxTTFB != 2*time.Second || config.HealthCheckInterval != 0 {
+		t.Errorf("nested settings not loaded: %+v", config)
+	}
+	if len(config.NoProxy) != 2 || len(config.Routes) != 3 || config.Routes[1].Action != RouteReject ||
+		config.Routes[0].Constraints.Types[0] != ProxySOCKS5 || config.Routes[0].Constraints.MinAnonymity != AnonymityElite {
+		t.Errorf("routing not loaded: %v %+v", config.NoProxy, config.Routes)
+	}
+	if config.SOCKSDNS != DNSRemote {
+		t.Errorf("socks_dns %s, want remote", config.SOCKSDNS)
+	}
+	if config.ProxyTLS == nil || config.ProxyTLS.ServerName != "proxy.example.com" {
+		t.Errorf("proxy_tls not loaded: %+v", config.ProxyTLS)
+	}
+	if paid := config.Pools["paid"]; paid == nil || paid.PoolSize != 5 || paid.RefreshInterval != 30*time.Second ||
+		paid.ProxyTLS != config.ProxyTLS {
+		t.Errorf("named pool not loaded or not inheriting: %+v", paid)
+	}
+	if config.MaxRetries != DefaultConfig().MaxRetries {
+		t.Errorf("unset MaxRetries = %d, want default", config.MaxRetries)
+	}
+}
+
+func TestLoadConfigJSONAndEnv(t *testing.T) {
+	path := writeConfig(t, "config.json", `{"pool_size": 20, "validation": {"timeout": "5s"}}`)
+	t.Setenv("PROXYGUN_POOL_SIZE", "7")
+	t.Setenv("PROXYGUN_GOOD_CODES", "200,201")
+	t.Setenv("PROXYGUN_PROVIDERS", "sslproxies, usproxy")
+	t.Setenv("PROXYGUN_VALIDATION_MAX_WORKERS", "5")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.PoolSize != 7 || config.ValidationTimeout != 5*time.Second || config.MaxValidationWorkers != 5 {
+		t.Errorf("got pool %d, timeout %s, workers %d", config.PoolSize, config.ValidationTimeout, config.MaxValidationWorkers)
+	}
+	if len(config.GoodCodes) != 2 || len(config.Providers) != 2 || config.Providers[1].Name != "usproxy" {
+		t.Errorf("got good codes %v, providers %+v", config.GoodCodes, config.Providers)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"unknown key", "c.yaml", "pool_sise: 3", "pool_sise"},
+		{"unknown key json", "c.json", `{"pool_sise": 3}`, "pool_sise"},
+		{"bad duration", "c.yaml", "refresh_interval: soon", `invalid duration "soon"`},
+		{"bad fallback", "c.yaml", "fallback: maybe", "fallback"},
+		{"unknown provider", "c.yaml", "providers: [{name: nope}]", "nope"},
+		{"invalid values", "c.yaml", "pool_size: 0\ngood_codes: [42]", "good_codes: 42"},
+		{"proxy tls pair", "c.yaml", "proxy_tls: {cert_file: client.pem}", "cert_file and key_file"},
+		{"proxy tls ca", "c.yaml", "proxy_tls: {ca_file: missing-ca.pem}", "proxy_tls.ca_file"},
+		{"hash missing", "c.yaml", "content_check: {url: http://example.com}", "content_check.sha256"},
+		{"extension", "c.toml", "", "unsupported extension"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Setenv("PROXYGUN_MAX_RETRIES", "many")
+	if _, err := LoadConfig(""); err == nil || !strings.Contains(err.Error(), "PROXYGUN_MAX_RETRIES") {
+		t.Errorf("env error = %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package proxygun
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// ErrNoMatchingProxy is returned when no pooled proxy satisfies the request
+// constraints and their fallback policy is FallbackFail
+var ErrNoMatchingProxy = errors.New("no pooled proxy matches the request constraints")
+
+// FallbackPolicy decides what happens when no pooled proxy satisfies the constraints
+type FallbackPolicy int
+
+const (
+	FallbackDefault  FallbackPolicy = iota // Behave as with an empty pool: use Config.FallbackTransport if set
+	FallbackAnyProxy                       // Ignore the constraints and use any pooled proxy
+	FallbackFail                           // Fail with ErrNoMatchingProxy, never go direct
+)
+
+// Constraints restrict which pooled proxies may serve a single request.
+// Zero fields impose no restriction.
+type Constraints struct {
+	Types        []ProxyType   // Allowed proxy types
+	Countries    []string      // Allowed two-letter country codes; proxies of unknown country never match
+	MinAnonymity Anonymity     // Minimum claimed anonymity level
+	MaxLatency   time.Duration // Maximum measured latency; unmeasured proxies match
+	Exclude      []string      // Proxies never to use, as host:port or proxy URL
+	RequireHTTPS bool          // Only proxies able to tunnel HTTPS: SOCKS, or HTTP(S) proxies claiming CONNECT support
+	Fallback     FallbackPolicy
+}
+
+// constraintMatcher is Constraints with its lists turned into lookup sets
+type constraintMatcher struct {
+	Constraints
+	countries map[string]bool
+	exclude   map[string]bool
+}
+
+type constraintsKey struct{}
+
+// WithConstraints returns a copy of ctx whose requests through RoundTrip and
+// DialContext only use pooled proxies satisfying c
+func WithConstraints(ctx context.Context, c Constraints) context.Context {
+	m := &constraintMatcher{Constraints: c}
+	if len(c.Countries) > 0 {
+		m.countries = make(map[string]bool, len(c.Countries))
+		for _, country := range c.Countries {
+			m.countries[proxy.NormalizeCountry(country)] = true
+		}
+	}
+	if len(c.Exclude) > 0 {
+		m.exclude = make(map[string]bool, len(c.Exclude))
+		for _, s := range c.Exclude {
+			if p, err := proxy.Parse(s); err == nil {
+				m.exclude[p.String()] = true
+			} else {
+				m.exclude[s] = true
+			}
+		}
+	}
+	return context.WithValue(ctx, constraintsKey{}, m)
+}
+
+func constraintsFromContext(ctx context.Context) *constraintMatcher {
+	m, _ := ctx.Value(constraintsKey{}).(*constraintMatcher)
+	return m
+}
+
+func (m *constraintMatcher) matches(px *proxy.ProxyWithStats) bool {
+	p := px.Proxy
+	if len(m.Types) > 0 && !slices.Contains(m.Types, p.Type) {
+		return false
+	}
+	if m.countries != nil && (p.Country == "" || !m.countries[p.Country]) {
+		return false
+	}
+	if p.Anonymity < m.MinAnonymity {
+		return false
+	}
+	if m.MaxLatency > 0 {
+		if latency := px.Latency(); latency > m.MaxLatency {
+			return false
+		}
+	}
+	if m.exclude[p.String()] {
+		return false
+	}
+	if m.RequireHTTPS && (p.Type == proxy.HTTP || p.Type == proxy.HTTPS) && !p.HTTPS {
+		return false
+	}
+	return true
+}
+
+// allowsDirect reports whether the request may fall back to a direct connection
+func allowsDirect(ctx context.Context, config *Config) bool {
+	if config.StrictNoDirect {
+		return false
+	}
+	if noDirect, _ := ctx.Value(noDirectKey{}).(bool); noDirect {
+		return false
+	}
+	m := constraintsFromContext(ctx)
+	return m == nil || m.Fallback != FallbackFail
+}
@@ -0,0 +1,91 @@
+package proxygun
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestNextProxyConstraints(t *testing.T) {
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(DefaultConfig())
+	rt.pool.Add(&proxy.Proxy{Host: "10.0.0.1", Port: 8080, Type: proxy.HTTP,
+		Metadata: proxy.Metadata{Country: "US", Anonymity: proxy.Transparent}})
+	rt.pool.Add(&proxy.Proxy{Host: "10.0.0.2", Port: 8080, Type: proxy.HTTP,
+		Metadata: proxy.Metadata{Country: "DE", Anonymity: proxy.Elite, HTTPS: true}})
+	rt.pool.Add(&proxy.Proxy{Host: "10.0.0.3", Port: 1080, Type: proxy.SOCKS5,
+		Metadata: proxy.Metadata{Country: "DE", Anonymity: proxy.Elite}})
+
+	slow := &proxy.Proxy{Host: "10.0.0.4", Port: 1080, Type: proxy.SOCKS5, Metadata: proxy.Metadata{Country: "FR"}}
+	slowStats := proxy.NewProxyWithStats(slow)
+	slowStats.RecordLatency(2 * time.Second)
+	rt.pool.AddWithStats(slowStats)
+
+	tests := []struct {
+		name        string
+		constraints Constraints
+		want        []string // acceptable proxies, none when empty
+	}{
+		{"types", Constraints{Types: []ProxyType{ProxyHTTP}}, []string{"10.0.0.1:8080", "10.0.0.2:8080"}},
+		{"countries", Constraints{Countries: []string{"us"}}, []string{"10.0.0.1:8080"}},
+		{"anonymity", Constraints{MinAnonymity: AnonymityElite, Types: []ProxyType{ProxyHTTP}}, []string{"10.0.0.2:8080"}},
+		{"latency", Constraints{MaxLatency: time.Second, Countries: []string{"FR"}}, nil},
+		{"exclude", Constraints{Exclude: []string{"socks5://10.0.0.3:1080"}, Countries: []string{"DE"}}, []string{"10.0.0.2:8080"}},
+		{"https", Constraints{RequireHTTPS: true, Types: []ProxyType{ProxyHTTP}}, []string{"10.0.0.2:8080"}},
+		{"fallback any", Constraints{Countries: []string{"JP"}, Fallback: FallbackAnyProxy},
+			[]string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.3:1080", "10.0.0.4:1080"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := WithConstraints(context.Background(), test.constraints)
+			for i := 0; i < 4; i++ {
+				px := rt.nextProxy(ctx)
+				if len(test.want) == 0 {
+					if px != nil {
+						t.Fatalf("got %s, want no proxy", px.Proxy)
+					}
+					continue
+				}
+				if px == nil {
+					t.Fatalf("got no proxy, want one of %v", test.want)
+				}
+				found := false
+				for _, want := range test.want {
+					found = found || px.Proxy.String() == want
+				}
+				if !found {
+					t.Fatalf("got %s, want one of %v", px.Proxy, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTripConstraintsFallbackFail(t *testing.T) {
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	config := DefaultConfig()
+	rt.config.Store(config)
+
+	rt.pool.Add(&proxy.Proxy{Host: "10.0.0.1", Port: 8080, Metadata: proxy.Metadata{Country: "DE"}})
+
+	// No pooled proxy matches, and the fallback transport must not be used
+	ctx := WithConstraints(context.Background(), Constraints{Countries: []string{"JP"}, Fallback: FallbackFail})
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com/", nil)
+	if resp, err := rt.RoundTrip(req); err != ErrNoMatchingProxy {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		t.Fatalf("RoundTrip error %v, want ErrNoMatchingProxy", err)
+	}
+	if _, err := rt.DialContext(ctx, "tcp", "127.0.0.1:1"); err != ErrNoMatchingProxy {
+		t.Fatalf("DialContext error %v, want ErrNoMatchingProxy", err)
+	}
+	if n := rt.directConnections.Load(); n != 0 {
+		t.Errorf("%d connections went direct", n)
+	}
+}
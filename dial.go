@@ -0,0 +1,119 @@
+package proxygun
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DialContext connects to addr through pooled proxies, tunnelling via HTTP
+// CONNECT or SOCKS4/5. Failed dials are retried on other proxies and recorded in
+// their stats, just like RoundTrip. It can be used as http.Transport.DialContext.
+func (rt *ProxyRoundTripper) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	config := rt.cfg()
+	ctx, err := rt.route(ctx, "", addr)
+	if err != nil {
+		return nil, err
+	}
+	if o := overrideFromContext(ctx); o != nil {
+		return rt.dialOverride(ctx, o, network, addr, config)
+	}
+
+	// Try the pools of the failover chain in order, queueing while they are empty
+	var tried attempts
+	wait := proxyWait{until: time.Now().Add(config.WaitForProxy)}
+	for {
+		for _, member := range rt.chain(ctx) {
+			if member == nil {
+				return rt.dialDirect(ctx, network, addr, &tried, config)
+			}
+			conn, err := member.dialProxies(ctx, network, addr, &tried)
+			if conn != nil || err != nil {
+				return conn, err
+			}
+		}
+		if tried.count > 0 || !rt.waitForProxy(ctx, &wait) {
+			break
+		}
+	}
+
+	// Tunnels fall back to a direct connection when HTTP requests would go direct too
+	if fallbackDials(config.FallbackTransport) && allowsDirect(ctx, config) {
+		return rt.dialDirect(ctx, network, addr, &tried, config)
+	}
+
+	if tried.count > 0 {
+		return nil, fmt.Errorf("all %d proxy attempts failed, last error: %w", tried.count, tried.lastErr)
+	}
+	return nil, noProxyError(ctx, config)
+}
+
+// dialProxies tries up to MaxRetries proxies of the pool. It returns neither
+// a connection nor an error when every attempt failed.
+func (rt *ProxyRoundTripper) dialProxies(ctx context.Context, network, addr string, tried *attempts) (net.Conn, error) {
+	config := rt.cfg()
+	for attempt := 0; attempt < config.MaxRetries; attempt++ {
+		proxyWithStats := rt.nextProxy(ctx)
+		if proxyWithStats == nil {
+			break // No proxies available
+		}
+
+		if proxyWithStats.IsBad(MinimalRequestsToCheckBad) {
+			rt.pool.MoveToBad(proxyWithStats.Proxy)
+			config.Logger.Info().Msgf("Proxy %s is bad, moving to bad pool", proxyWithStats.Proxy.String())
+			attempt--
+			continue
+		}
+
+		tried.count++
+		start := time.Now()
+		conn, err := rt.dialer.Load().DialContext(ctx, proxyWithStats.Proxy.WithResolution(config.SOCKSDNS), network, addr)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			proxyWithStats.RecordFailure()
+			tried.lastErr = err
+			continue
+		}
+
+		proxyWithStats.RecordSuccess()
+		proxyWithStats.RecordLatency(time.Since(start))
+		return conn, nil
+	}
+	return nil, nil
+}
+
+// fallbackDials reports whether the fallback transport connects directly, so
+// tunnels may fall back to a plain dial. A custom transport may reach the
+// internet through its own proxy or dialer, which DialContext cannot reuse,
+// and then failed tunnels are not sent from the host's own IP.
+func fallbackDials(t http.RoundTripper) bool {
+	if t == http.DefaultTransport {
+		return true
+	}
+	transport, ok := t.(*http.Transport)
+	return ok && transport.Proxy == nil && transport.DialContext == nil && transport.Dial == nil && transport.DialTLSContext == nil
+}
+
+// dialDirect connects to addr directly after the proxy attempts
+func (rt *ProxyRoundTripper) dialDirect(ctx context.Context, network, addr string, tried *attempts, config *Config) (net.Conn, error) {
+	if err := rt.egressDirect(config); err != nil {
+		return nil, err
+	}
+	conn, err := (&net.Dialer{Timeout: 30 * time.Second}).DialContext(ctx, network, addr)
+	if err != nil {
+		if tried.count > 0 {
+			return nil, fmt.Errorf("all %d proxy attempts failed (last proxy error: %v), direct dial also failed: %w", tried.count, tried.lastErr, err)
+		}
+		return nil, fmt.Errorf("no proxies available, direct dial failed: %w", err)
+	}
+	return conn, nil
+}
+
+// Dial connects to addr through pooled proxies
+func (rt *ProxyRoundTripper) Dial(network, addr string) (net.Conn, error) {
+	return rt.DialContext(context.Background(), network, addr)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+
+	"github.com/aredoff/proxygun"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	config := proxygun.DefaultConfig()
+	config.PoolSize = 10
+
+	rt := proxygun.NewProxyRoundTripper(config)
+	defer rt.Close()
+
+	// Use with: curl -x localhost:8080 https://httpbin.org/ip
+	server := proxygun.NewProxyServer(rt)
+	log.Info().Msg("Listening on localhost:8080")
+	if err := server.ListenAndServe("localhost:8080"); err != nil {
+		log.Fatal().Err(err).Msg("Proxy server stopped")
+	}
+}
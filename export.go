@@ -0,0 +1,73 @@
+package proxygun
+
+import (
+	"io"
+	"slices"
+
+	"github.com/aredoff/proxygun/internal/format"
+	"github.com/aredoff/proxygun/internal/parser"
+	"github.com/aredoff/proxygun/internal/parser/providers"
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// Export writes pooled proxies in the given format: "plain", "url", "jsonl",
+// "csv", "clash" or "singbox". Segments select among "main", "free" and "bad";
+// main and free proxies are exported when none are given.
+func (rt *ProxyRoundTripper) Export(w io.Writer, formatName string, segments ...string) error {
+	f, err := format.Parse(formatName)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		segments = []string{pool.SegmentMain, pool.SegmentFree}
+	}
+
+	snapshot := rt.pool.Snapshot()
+	records := make([]format.Record, 0, len(snapshot.Entries))
+	for _, entry := range snapshot.Entries {
+		if !slices.Contains(segments, entry.Segment) {
+			continue
+		}
+		p, err := proxy.Parse(entry.Proxy)
+		if err != nil {
+			continue
+		}
+		p.Metadata = entry.Metadata
+		records = append(records, format.Record{
+			Proxy:   p,
+			Segment: entry.Segment,
+			Stats:   entry.Stats,
+		})
+	}
+
+	return format.Encode(w, f, records)
+}
+
+// Import reads proxies in the given format, validates them and adds those
+// that pass to the pool. It returns how many proxies were added.
+func (rt *ProxyRoundTripper) Import(r io.Reader, formatName string) (int, error) {
+	f, err := format.Parse(formatName)
+	if err != nil {
+		return 0, err
+	}
+
+	records, err := format.Decode(r, f)
+	if err != nil {
+		return 0, err
+	}
+
+	proxies := make([]*proxy.Proxy, 0, len(records))
+	for _, record := range records {
+		proxies = append(proxies, record.Proxy)
+	}
+	return len(rt.addCandidates(rt.ctx, proxies, "import")), nil
+}
+
+func fileProviders(paths []string) []parser.Parser {
+	parsers := make([]parser.Parser, 0, len(paths))
+	for _, path := range paths {
+		parsers = append(parsers, providers.NewFileProvider(path))
+	}
+	return parsers
+}
@@ -0,0 +1,76 @@
+package proxygun
+
+import (
+	"strings"
+
+	"github.com/aredoff/proxygun/internal/geoip"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// openGeoIP loads the configured databases, nil when none are configured
+func openGeoIP(config *Config) (*geoip.DB, error) {
+	if len(config.GeoIPDatabases) == 0 {
+		return nil, nil
+	}
+	return geoip.Open(config.GeoIPDatabases...)
+}
+
+func geoFilter(config *Config) geoip.Filter {
+	upper := func(codes []string) []string {
+		out := make([]string, 0, len(codes))
+		for _, code := range codes {
+			out = append(out, strings.ToUpper(strings.TrimSpace(code)))
+		}
+		return out
+	}
+	return geoip.Filter{
+		AllowCountries:  upper(config.AllowCountries),
+		DenyCountries:   upper(config.DenyCountries),
+		AllowASNs:       config.AllowASNs,
+		DenyASNs:        config.DenyASNs,
+		DenyDatacenter:  config.DenyDatacenter,
+		DenyResidential: config.DenyResidential,
+	}
+}
+
+// admitCandidate enriches p from the GeoIP databases and reports whether the
+// configured filters let it through to validation. With filters set, proxies
+// whose lookup fails, such as names that do not resolve, are rejected.
+func (rt *ProxyRoundTripper) admitCandidate(p *proxy.Proxy) bool {
+	config := rt.cfg()
+	filter := geoFilter(config)
+	if db := rt.geo.Load(); db != nil {
+		if err := db.Enrich(p); err != nil {
+			config.Logger.Debug().Msgf("GeoIP lookup of %s failed: %v", p.String(), err)
+			if !filter.Empty() {
+				return false
+			}
+		}
+	}
+
+	if filter.Empty() {
+		return true
+	}
+	if err := filter.Check(&p.Metadata); err != nil {
+		config.Logger.Debug().Msgf("Rejected candidate %s: %v", p.String(), err)
+		return false
+	}
+	return true
+}
+
+// evictFiltered removes pooled proxies the current GeoIP databases and filters
+// no longer admit, after a Reload changed them
+func (rt *ProxyRoundTripper) evictFiltered() {
+	evicted := 0
+	for _, px := range rt.pool.Proxies() {
+		// Enrich a copy, the pooled proxy is read by requests in flight
+		candidate := *px.Proxy
+		if !rt.admitCandidate(&candidate) {
+			rt.pool.Remove(px.Proxy)
+			evicted++
+		}
+	}
+	if evicted > 0 {
+		rt.cfg().Logger.Info().Msgf("Evicted %d pooled proxies rejected by the new GeoIP filters", evicted)
+	}
+}
@@ -0,0 +1,103 @@
+package proxygun
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/parser"
+	"github.com/aredoff/proxygun/internal/parser/providers"
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+	"github.com/rs/zerolog"
+)
+
+func TestGeoFilterPooledProxies(t *testing.T) {
+	config := DefaultConfig()
+	config.Logger = zerolog.Nop()
+	config.HealthCheckInterval = 0
+	config.StatePath = filepath.Join(t.TempDir(), "state.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt := &ProxyRoundTripper{
+		pool:      pool.NewPool(10, 10),
+		parser:    parser.NewMultiParser(nil),
+		refreshCh: make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	rt.config.Store(config)
+	rt.validator.Store(newValidator(config))
+
+	de := &proxy.Proxy{Host: "10.0.0.1", Port: 80, Metadata: proxy.Metadata{Country: "DE"}}
+	us := &proxy.Proxy{Host: "10.0.0.2", Port: 80, Metadata: proxy.Metadata{Country: "US"}}
+	rt.pool.Add(de)
+	rt.pool.Add(us)
+	if err := rt.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Tightening the filters evicts pooled proxies they reject
+	filtered := *config
+	filtered.AllowCountries = []string{"de"}
+	if err := rt.Reload(&filtered); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for rt.pool.Contains(us) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if rt.pool.Contains(us) || !rt.pool.Contains(de) {
+		t.Fatalf("after reload: US pooled %t, DE pooled %t", rt.pool.Contains(us), rt.pool.Contains(de))
+	}
+
+	// Saved state passes through the filters too
+	rt.pool.Drain()
+	rt.loadState()
+	if rt.pool.Contains(us) || !rt.pool.Contains(de) {
+		t.Errorf("after restore: US pooled %t, DE pooled %t", rt.pool.Contains(us), rt.pool.Contains(de))
+	}
+
+	// And so do proxies the admin API adds without validation
+	w := httptest.NewRecorder()
+	rt.AdminHandler().ServeHTTP(w, httptest.NewRequest("POST", "/proxies", strings.NewReader(`{"proxy": "10.0.0.3:80"}`)))
+	if !strings.Contains(w.Body.String(), `"added":false`) || rt.pool.Size() != 1 {
+		t.Errorf("admin add of a proxy of unknown country answered %s", w.Body)
+	}
+}
+
+func TestGeoFilterCandidates(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "list.jsonl")
+	lines := `{"proxy": "http://127.0.0.1:1", "country": "DE"}
+{"proxy": "http://127.0.0.1:2", "country": "US"}
+{"proxy": "http://127.0.0.1:3", "country": "US"}
+`
+	if err := os.WriteFile(list, []byte(lines), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.Logger = zerolog.Nop()
+	config.AllowCountries = []string{"DE"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt := &ProxyRoundTripper{
+		pool:   pool.NewPool(10, 10),
+		parser: parser.NewMultiParser([]parser.Source{parser.NewSource(providers.NewFileProvider(list), parser.Schedule{})}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	rt.config.Store(config)
+	rt.validator.Store(newValidator(config))
+
+	// Only the proxy the filters admit counts towards the provider's yield
+	rt.refreshProxies(true)
+	status := rt.parser.Providers()
+	if len(status) != 1 || status[0].Health.Candidates != 1 || status[0].Health.Validated != 0 {
+		t.Errorf("provider status after refresh: %+v", status)
+	}
+}
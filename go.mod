@@ -4,14 +4,17 @@ go 1.25.1
 
 require (
 	github.com/PuerkitoBio/goquery v1.10.0
+	github.com/maxmind/mmdbwriter v1.0.0
+	github.com/oschwald/maxminddb-golang v1.12.0
 	github.com/rs/zerolog v1.34.0
 	golang.org/x/net v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/andybalholm/cascadia v1.3.2 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
+	go4.org/netipx v0.0.0-20220812043211-3cc044ffd68d // indirect
 	golang.org/x/sys v0.26.0 // indirect
-	h12.io/socks v1.0.3 // indirect
 )
@@ -0,0 +1,98 @@
+package proxygun
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// healthCheckWorker periodically re-validates idle proxies so dead ones are
+// evicted before user traffic reaches them. interval is the one the worker was
+// started with; a Reload may have changed the config since.
+func (rt *ProxyRoundTripper) healthCheckWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Pick up interval changes from Reload
+			config := rt.keepWorker(&rt.healthChecking, healthCheckEnabled)
+			if config == nil {
+				return
+			}
+			ticker.Reset(config.HealthCheckInterval)
+			rt.healthCheck()
+		case <-rt.ctx.Done():
+			rt.keepWorker(&rt.healthChecking, healthCheckEnabled)
+			return
+		}
+	}
+}
+
+func (rt *ProxyRoundTripper) healthCheck() {
+	config := rt.cfg()
+	if config.FreePoolMaxAge > 0 {
+		if dropped := rt.pool.DropStaleFree(config.FreePoolMaxAge); dropped > 0 {
+			config.Logger.Info().Msgf("Dropped %d stale proxies from free pool", dropped)
+		}
+	}
+
+	idle := rt.pool.Idle(config.HealthCheckIdle, config.HealthCheckBatch)
+	if len(idle) == 0 {
+		return
+	}
+
+	if evicted := rt.revalidate(idle); evicted > 0 {
+		config.Logger.Info().Msgf("Health check evicted %d of %d idle proxies", evicted, len(idle))
+	}
+}
+
+// revalidate validates proxies, ValidationWorkers at a time, and removes the
+// ones that fail from the pool. It returns how many were removed.
+func (rt *ProxyRoundTripper) revalidate(proxies []*proxy.ProxyWithStats) int64 {
+	config := rt.cfg()
+	v := rt.currentValidator()
+	jobs := make(chan *proxy.ProxyWithStats)
+	var wg sync.WaitGroup
+	var evicted atomic.Int64
+
+	for w := 0; w < min(max(config.ValidationWorkers, 1), len(proxies)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				result := v.ValidateProxy(rt.ctx, p.Proxy)
+				if !result.Valid {
+					if rt.ctx.Err() != nil {
+						continue // Aborted by Close, not a verdict on the proxy
+					}
+					// Dropped rather than banned: the failure may be transient,
+					// and a provider listing the proxy again brings it back
+					rt.pool.Remove(p.Proxy)
+					evicted.Add(1)
+					continue
+				}
+
+				p.RecordCheck()
+				p.RecordLatency(result.TTFB)
+				p.RecordThroughput(result.Throughput)
+			}
+		}()
+	}
+
+feed:
+	for _, p := range proxies {
+		select {
+		case jobs <- p:
+		case <-rt.ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return evicted.Load()
+}
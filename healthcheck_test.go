@@ -0,0 +1,53 @@
+package proxygun
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestHealthCheckEviction(t *testing.T) {
+	// A working HTTP proxy answering the validation URL
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	// A closed port fails the TCP check
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, _ := proxy.Parse(l.Addr().String())
+	l.Close()
+
+	config := DefaultConfig()
+	config.ValidationURL = "http://check.example/"
+	config.HealthCheckIdle = 0
+	config.FreePoolMaxAge = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10), ctx: ctx, cancel: cancel}
+	rt.config.Store(config)
+	rt.validator.Store(newValidator(config))
+
+	alive, _ := proxy.Parse(upstream.Listener.Addr().String())
+	rt.pool.Add(alive)
+	rt.pool.Add(dead)
+	time.Sleep(time.Millisecond) // Both become idle
+
+	rt.healthCheck()
+	if rt.pool.Contains(dead) || rt.pool.BadSize() != 0 {
+		t.Errorf("dead proxy kept or banned: contains %t, bad %d", rt.pool.Contains(dead), rt.pool.BadSize())
+	}
+	if px := rt.pool.Find(alive); px == nil || px.StatsSnapshot().LastChecked.IsZero() {
+		t.Errorf("working proxy evicted or not marked as checked")
+	}
+	if !rt.pool.Add(dead) {
+		t.Error("an evicted proxy cannot come back from a provider")
+	}
+}
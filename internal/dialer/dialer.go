@@ -0,0 +1,125 @@
+package dialer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// DialFunc dials a network address
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Dialer opens TCP connections to a target through a single upstream proxy
+type Dialer struct {
+	Timeout time.Duration
+	// Forward dials the proxy itself, net.Dialer is used when nil
+	Forward DialFunc
+	// TLS configures connections to HTTPS proxies. ServerName defaults to the
+	// proxy host and a nil config verifies against the system roots.
+	TLS *tls.Config
+}
+
+func New(timeout time.Duration) *Dialer {
+	return &Dialer{Timeout: timeout}
+}
+
+// DialContext connects to addr through the proxy p
+func (d *Dialer) DialContext(ctx context.Context, p *proxy.Proxy, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("network %s is not supported through proxies", network)
+	}
+
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	switch p.Type {
+	case proxy.HTTP, proxy.HTTPS:
+		return d.dialHTTP(ctx, p, addr)
+	case proxy.SOCKS4:
+		return d.dialSOCKS4(ctx, p, addr)
+	case proxy.SOCKS5:
+		return d.dialSOCKS5(ctx, p, addr)
+	default:
+		return nil, errors.New("unsupported proxy type")
+	}
+}
+
+// DialProxy connects to the proxy p itself, completing the TLS handshake
+// for HTTPS proxies
+func (d *Dialer) DialProxy(ctx context.Context, p *proxy.Proxy) (net.Conn, error) {
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	address := p.String()
+	var conn net.Conn
+	var err error
+	if d.Forward != nil {
+		conn, err = d.Forward(ctx, "tcp", address)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	}
+	if err != nil || p.Type != proxy.HTTPS {
+		return conn, err
+	}
+
+	config := d.TLS.Clone()
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config.ServerName = p.Host
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with proxy %s: %w", address, err)
+	}
+	return tlsConn, nil
+}
+
+// handshake runs fn on conn bounded by the context and closes conn on failure
+func handshake(ctx context.Context, conn net.Conn, fn func() error) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	stop := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			// Unblock pending reads and writes
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	err := fn()
+	close(stop)
+	<-exited
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return nil
+}
@@ -0,0 +1,71 @@
+package dialer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// dialHTTP opens a tunnel with the HTTP CONNECT method
+func (d *Dialer) dialHTTP(ctx context.Context, p *proxy.Proxy, addr string) (net.Conn, error) {
+	conn, err := d.DialProxy(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader *bufio.Reader
+	err = handshake(ctx, conn, func() error {
+		req := &http.Request{
+			Method: http.MethodConnect,
+			URL:    &url.URL{Opaque: addr},
+			Host:   addr,
+			Header: make(http.Header),
+		}
+		if err := req.Write(conn); err != nil {
+			return err
+		}
+
+		reader = bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("proxy refused CONNECT: %s", resp.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn returns bytes the proxy sent right after its CONNECT response
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// CloseWrite half-closes the tunnel so the far end sees the end of the data
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Close()
+}
@@ -0,0 +1,145 @@
+package dialer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestDialHTTPS(t *testing.T) {
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("hello"))
+		conn.Close()
+	}()
+
+	// An HTTP proxy behind TLS answering CONNECT
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	defer server.Close()
+
+	p, err := proxy.Parse("https://" + server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != proxy.HTTPS || p.URL().Scheme != "https" {
+		t.Fatalf("parsed %+v, want an HTTPS proxy", p)
+	}
+
+	// The test certificate is not in the system roots
+	if _, err := New(0).DialContext(context.Background(), p, "tcp", target.Addr().String()); err == nil {
+		t.Fatal("DialContext trusted an unknown proxy certificate")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	d := New(0)
+	d.TLS = &tls.Config{RootCAs: roots}
+	conn, err := d.DialContext(context.Background(), p, "tcp", target.Addr().String())
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	defer conn.Close()
+	if got, err := io.ReadAll(conn); err != nil || string(got) != "hello" {
+		t.Errorf("read %q, %v through the tunnel, want hello", got, err)
+	}
+}
+
+func TestDialHTTPHalfClose(t *testing.T) {
+	// A target that answers once the client has finished sending
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	go func() {
+		conn, err := target.Accept()
+		if err != nil {
+			return
+		}
+		data, _ := io.ReadAll(conn)
+		conn.Write(data)
+		conn.Close()
+	}()
+
+	// A CONNECT proxy that sends a greeting in the same packet as its response,
+	// so the tunnel comes back wrapped in a bufferedConn
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\nhi:"))
+		done := make(chan struct{})
+		go func() {
+			io.Copy(conn, upstream)
+			conn.(*net.TCPConn).CloseWrite()
+			close(done)
+		}()
+		io.Copy(upstream, conn)
+		upstream.(*net.TCPConn).CloseWrite()
+		<-done
+	}))
+	defer server.Close()
+
+	p, _ := proxy.Parse(server.Listener.Addr().String())
+	conn, err := New(0).DialContext(context.Background(), p, "tcp", target.Addr().String())
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	defer conn.Close()
+	cw, ok := conn.(interface{ CloseWrite() error })
+	if !ok {
+		t.Fatalf("%T cannot half-close", conn)
+	}
+	conn.Write([]byte("ping"))
+	if err := cw.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(conn); err != nil || string(got) != "hi:ping" {
+		t.Errorf("read %q, %v through the tunnel, want hi:ping", got, err)
+	}
+}
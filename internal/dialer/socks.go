@@ -0,0 +1,147 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+	xproxy "golang.org/x/net/proxy"
+)
+
+// dialSOCKS4 opens a tunnel with the SOCKS4 CONNECT command. Plain SOCKS4
+// only carries IPv4 addresses, so hostnames are resolved locally unless the
+// proxy resolves remotely, in which case they are sent with the SOCKS4a extension.
+func (d *Dialer) dialSOCKS4(ctx context.Context, p *proxy.Proxy, addr string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	var ip net.IP
+	var hostname []byte
+	if literal := net.ParseIP(host); literal != nil && literal.To4() == nil {
+		return nil, fmt.Errorf("socks4 cannot connect to IPv6 address %s", host)
+	}
+	if ip = net.ParseIP(host).To4(); ip == nil {
+		if p.RemoteResolution() {
+			ip = net.IPv4(0, 0, 0, 1).To4() // SOCKS4a marker, the hostname follows the user id
+			hostname = append([]byte(host), 0)
+		} else if ip, err = lookupIPv4(ctx, host); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := d.DialProxy(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	err = handshake(ctx, conn, func() error {
+		req := []byte{
+			4,                          // version number
+			1,                          // command CONNECT
+			byte(port >> 8),            // destination port, big endian
+			byte(port),                 //
+			ip[0], ip[1], ip[2], ip[3], // destination address
+			0, // empty user id
+		}
+		req = append(req, hostname...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+
+		resp := make([]byte, 8)
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return err
+		}
+		if resp[1] != 90 {
+			return fmt.Errorf("socks4 connection request rejected (code %d)", resp[1])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// dialSOCKS5 opens a tunnel with the SOCKS5 CONNECT command, sending
+// hostnames to the proxy unless it is set to resolve locally
+func (d *Dialer) dialSOCKS5(ctx context.Context, p *proxy.Proxy, addr string) (net.Conn, error) {
+	if !p.RemoteResolution() {
+		resolved, err := lookupAddr(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		addr = resolved
+	}
+
+	address := net.JoinHostPort(p.Host, fmt.Sprintf("%d", p.Port))
+	socksDialer, err := xproxy.SOCKS5("tcp", address, nil, forwardDialer{d: d, p: p})
+	if err != nil {
+		return nil, err
+	}
+
+	contextDialer, ok := socksDialer.(xproxy.ContextDialer)
+	if !ok {
+		return nil, errors.New("socks5 dialer does not support contexts")
+	}
+	return contextDialer.DialContext(ctx, "tcp", addr)
+}
+
+// forwardDialer lets the x/net SOCKS5 client reach the proxy through Dialer.Forward
+type forwardDialer struct {
+	d *Dialer
+	p *proxy.Proxy
+}
+
+func (f forwardDialer) Dial(network, addr string) (net.Conn, error) {
+	return f.DialContext(context.Background(), network, addr)
+}
+
+func (f forwardDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return f.d.DialProxy(ctx, f.p)
+}
+
+// lookupAddr resolves the host of addr locally
+func lookupAddr(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no address found for host: %s", host)
+	}
+	return net.JoinHostPort(ips[0].IP.String(), port), nil
+}
+
+func lookupIPv4(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		return ip, nil
+	}
+
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no IPv4 address found for host: %s", host)
+	}
+	return ips[0].To4(), nil
+}
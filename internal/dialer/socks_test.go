@@ -0,0 +1,72 @@
+package dialer
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// serveSOCKS4 accepts one SOCKS4 CONNECT and reports the requested destination
+func serveSOCKS4(t *testing.T, l net.Listener, dest chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := r.ReadString(0); err != nil { // user id
+		t.Error(err)
+		return
+	}
+	host := net.IP(head[4:8]).String()
+	if head[4] == 0 && head[5] == 0 && head[6] == 0 && head[7] != 0 {
+		name, err := r.ReadString(0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		host = name[:len(name)-1]
+	}
+	dest <- net.JoinHostPort(host, strconv.Itoa(int(head[2])<<8|int(head[3])))
+	conn.Write([]byte{0, 90, 0, 0, 0, 0, 0, 0})
+}
+
+func TestDialSOCKS4a(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	dest := make(chan string, 1)
+	go serveSOCKS4(t, l, dest)
+
+	p, err := proxy.Parse("socks4a://" + l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != proxy.SOCKS4 || !p.RemoteResolution() || p.URL().Scheme != "socks4a" {
+		t.Fatalf("parsed %+v, want SOCKS4 with remote resolution", p)
+	}
+
+	// The .invalid name cannot resolve locally, so success means it was sent to the proxy
+	conn, err := New(0).DialContext(context.Background(), p, "tcp", "target.invalid:8080")
+	if err != nil {
+		t.Fatalf("DialContext: %v", err)
+	}
+	conn.Close()
+	if got := <-dest; got != "target.invalid:8080" {
+		t.Errorf("proxy asked to connect to %s, want target.invalid:8080", got)
+	}
+}
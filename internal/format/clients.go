@@ -0,0 +1,155 @@
+package format
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+	"gopkg.in/yaml.v3"
+)
+
+type clashConfig struct {
+	Proxies []clashProxy `yaml:"proxies"`
+}
+
+type clashProxy struct {
+	Name   string `yaml:"name"`
+	Type   string `yaml:"type"`
+	Server string `yaml:"server"`
+	Port   int    `yaml:"port"`
+	TLS    bool   `yaml:"tls,omitempty"`
+}
+
+// encodeClash writes a Clash proxies section. Clash has no SOCKS4 support,
+// so SOCKS4 proxies are left out.
+func encodeClash(w io.Writer, records []Record) error {
+	config := clashConfig{Proxies: make([]clashProxy, 0, len(records))}
+	for _, r := range records {
+		if r.Proxy.Type == proxy.SOCKS4 {
+			continue
+		}
+		cp := clashProxy{
+			Name:   name(r.Proxy),
+			Type:   r.Proxy.Type.String(),
+			Server: r.Proxy.Host,
+			Port:   r.Proxy.Port,
+		}
+		if r.Proxy.Type == proxy.HTTPS {
+			cp.Type, cp.TLS = "http", true // Clash marks HTTPS proxies with tls
+		}
+		config.Proxies = append(config.Proxies, cp)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func decodeClash(r io.Reader) ([]Record, error) {
+	var config clashConfig
+	if err := yaml.NewDecoder(r).Decode(&config); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	var records []Record
+	for _, cp := range config.Proxies {
+		proxyType, err := proxy.ParseType(cp.Type)
+		if err != nil || cp.Port <= 0 {
+			continue
+		}
+		host, err := proxy.NormalizeHost(cp.Server)
+		if err != nil {
+			continue
+		}
+		if proxyType == proxy.HTTP && cp.TLS {
+			proxyType = proxy.HTTPS
+		}
+		records = append(records, Record{Proxy: &proxy.Proxy{
+			Host: host,
+			Port: cp.Port,
+			Type: proxyType,
+		}})
+	}
+	return records, nil
+}
+
+type singBoxConfig struct {
+	Outbounds []singBoxOutbound `json:"outbounds"`
+}
+
+type singBoxOutbound struct {
+	Type       string      `json:"type"`
+	Tag        string      `json:"tag"`
+	Server     string      `json:"server,omitempty"`
+	ServerPort int         `json:"server_port,omitempty"`
+	Version    string      `json:"version,omitempty"`
+	TLS        *singBoxTLS `json:"tls,omitempty"`
+}
+
+type singBoxTLS struct {
+	Enabled bool `json:"enabled"`
+}
+
+func encodeSingBox(w io.Writer, records []Record) error {
+	config := singBoxConfig{Outbounds: make([]singBoxOutbound, 0, len(records))}
+	for _, r := range records {
+		outbound := singBoxOutbound{
+			Type:       "http",
+			Tag:        name(r.Proxy),
+			Server:     r.Proxy.Host,
+			ServerPort: r.Proxy.Port,
+		}
+		switch r.Proxy.Type {
+		case proxy.SOCKS4:
+			outbound.Type, outbound.Version = "socks", "4"
+		case proxy.SOCKS5:
+			outbound.Type, outbound.Version = "socks", "5"
+		case proxy.HTTPS:
+			outbound.TLS = &singBoxTLS{Enabled: true}
+		}
+		config.Outbounds = append(config.Outbounds, outbound)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(config)
+}
+
+func decodeSingBox(r io.Reader) ([]Record, error) {
+	var config singBoxConfig
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for _, outbound := range config.Outbounds {
+		host, err := proxy.NormalizeHost(outbound.Server)
+		if err != nil || outbound.ServerPort <= 0 {
+			continue
+		}
+
+		var proxyType proxy.Type
+		switch {
+		case outbound.Type == "http" && outbound.TLS != nil && outbound.TLS.Enabled:
+			proxyType = proxy.HTTPS
+		case outbound.Type == "http":
+			proxyType = proxy.HTTP
+		case outbound.Type == "socks" && (outbound.Version == "4" || outbound.Version == "4a"):
+			proxyType = proxy.SOCKS4
+		case outbound.Type == "socks":
+			proxyType = proxy.SOCKS5
+		default:
+			continue // Other outbound types are not proxies proxygun can use
+		}
+
+		records = append(records, Record{Proxy: &proxy.Proxy{
+			Host: host,
+			Port: outbound.ServerPort,
+			Type: proxyType,
+		}})
+	}
+	return records, nil
+}
@@ -0,0 +1,102 @@
+package format
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// Format is a proxy list serialization
+type Format string
+
+const (
+	Plain   Format = "plain"   // host:port per line
+	URL     Format = "url"     // scheme://host:port per line
+	JSONL   Format = "jsonl"   // one JSON object with stats per line
+	CSV     Format = "csv"     // header row followed by one proxy per row
+	Clash   Format = "clash"   // Clash "proxies" YAML
+	SingBox Format = "singbox" // sing-box "outbounds" JSON
+)
+
+// Record is a proxy with the pool segment and stats it is exported with
+type Record struct {
+	Proxy   *proxy.Proxy
+	Segment string
+	Stats   proxy.Stats
+}
+
+// Parse returns the format with the given name
+func Parse(name string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(name))); f {
+	case Plain, URL, JSONL, CSV, Clash, SingBox:
+		return f, nil
+	case "txt":
+		return Plain, nil
+	case "yaml", "yml":
+		return Clash, nil
+	default:
+		return "", fmt.Errorf("unknown proxy list format %q", name)
+	}
+}
+
+// Detect guesses the format of a file from its extension, defaulting to URL
+// lists which also accept bare host:port lines
+func Detect(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return JSONL
+	case ".csv":
+		return CSV
+	case ".yaml", ".yml":
+		return Clash
+	case ".json":
+		return SingBox
+	default:
+		return URL
+	}
+}
+
+// Encode writes records to w in the given format
+func Encode(w io.Writer, f Format, records []Record) error {
+	switch f {
+	case Plain, URL:
+		return encodeLines(w, f, records)
+	case JSONL:
+		return encodeJSONL(w, records)
+	case CSV:
+		return encodeCSV(w, records)
+	case Clash:
+		return encodeClash(w, records)
+	case SingBox:
+		return encodeSingBox(w, records)
+	default:
+		return fmt.Errorf("unknown proxy list format %q", f)
+	}
+}
+
+// Decode reads proxies from r in the given format. Stats are restored where
+// the format carries them.
+func Decode(r io.Reader, f Format) ([]Record, error) {
+	switch f {
+	case Plain, URL:
+		return decodeLines(r)
+	case JSONL:
+		return decodeJSONL(r)
+	case CSV:
+		return decodeCSV(r)
+	case Clash:
+		return decodeClash(r)
+	case SingBox:
+		return decodeSingBox(r)
+	default:
+		return nil, fmt.Errorf("unknown proxy list format %q", f)
+	}
+}
+
+// name returns a stable identifier used by formats that require named proxies
+func name(p *proxy.Proxy) string {
+	return fmt.Sprintf("%s-%s", p.Type, p.String())
+}
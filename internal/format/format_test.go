@@ -0,0 +1,93 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func testRecords() []Record {
+	return []Record{
+		{Proxy: &proxy.Proxy{Host: "10.0.0.1", Port: 8080, Type: proxy.HTTP, Metadata: proxy.Metadata{
+			Source: "SSLProxies", DiscoveredAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			Country: "DE", Anonymity: proxy.Elite, HTTPS: true,
+		}}, Segment: "main",
+			Stats: proxy.Stats{TotalRequests: 10, SuccessRequests: 9, FailedRequests: 1, Latency: 250 * time.Millisecond}},
+		{Proxy: &proxy.Proxy{Host: "10.0.0.2", Port: 1080, Type: proxy.SOCKS5}, Segment: "free"},
+		{Proxy: &proxy.Proxy{Host: "2001:db8::4", Port: 443, Type: proxy.HTTPS}, Segment: "main"},
+		{Proxy: &proxy.Proxy{Host: "10.0.0.3", Port: 4145, Type: proxy.SOCKS4}, Segment: "bad"},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		format     Format
+		wantTypes  bool // format preserves proxy types
+		wantStats  bool // format preserves stats
+		skipSOCKS4 bool
+	}{
+		{Plain, false, false, false},
+		{URL, true, false, false},
+		{JSONL, true, true, false},
+		{CSV, true, true, false},
+		{Clash, true, false, true},
+		{SingBox, true, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, test.format, testRecords()); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+
+			decoded, err := Decode(&buf, test.format)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+
+			want := testRecords()
+			if test.skipSOCKS4 {
+				want = want[:3]
+			}
+			if len(decoded) != len(want) {
+				t.Fatalf("decoded %d records, want %d", len(decoded), len(want))
+			}
+
+			for i, r := range decoded {
+				if r.Proxy.String() != want[i].Proxy.String() {
+					t.Errorf("record %d: proxy %s, want %s", i, r.Proxy, want[i].Proxy)
+				}
+				if test.wantTypes && r.Proxy.Type != want[i].Proxy.Type {
+					t.Errorf("record %d: type %s, want %s", i, r.Proxy.Type, want[i].Proxy.Type)
+				}
+				if test.wantStats && r.Stats.TotalRequests != want[i].Stats.TotalRequests {
+					t.Errorf("record %d: total requests %d, want %d", i, r.Stats.TotalRequests, want[i].Stats.TotalRequests)
+				}
+				got, wantMeta := r.Proxy.Metadata, want[i].Proxy.Metadata
+				if test.wantStats && (got.Source != wantMeta.Source || !got.DiscoveredAt.Equal(wantMeta.DiscoveredAt) ||
+					got.Country != wantMeta.Country || got.Anonymity != wantMeta.Anonymity || got.HTTPS != wantMeta.HTTPS) {
+					t.Errorf("record %d: metadata %+v, want %+v", i, got, wantMeta)
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeLinesSkipsInvalid(t *testing.T) {
+	input := "# comment\n1.2.3.4:80\n\nsocks5://5.6.7.8:1080\nnot a proxy\nftp://1.1.1.1:21\n"
+
+	records, err := Decode(strings.NewReader(input), URL)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("decoded %d records, want 2", len(records))
+	}
+	if records[1].Proxy.Type != proxy.SOCKS5 {
+		t.Errorf("second record type %s, want socks5", records[1].Proxy.Type)
+	}
+}
@@ -0,0 +1,217 @@
+package format
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func encodeLines(w io.Writer, f Format, records []Record) error {
+	bw := bufio.NewWriter(w)
+	for _, r := range records {
+		line := r.Proxy.String()
+		if f == URL {
+			line = r.Proxy.URL().String()
+		}
+		if _, err := fmt.Fprintln(bw, line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func decodeLines(r io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p, err := proxy.Parse(line)
+		if err != nil {
+			continue
+		}
+		records = append(records, Record{Proxy: p})
+	}
+	return records, scanner.Err()
+}
+
+// jsonRecord is the JSON lines representation of a Record
+type jsonRecord struct {
+	Proxy   string       `json:"proxy"`
+	Type    string       `json:"type"`
+	Host    string       `json:"host"`
+	Port    int          `json:"port"`
+	Segment string       `json:"segment,omitempty"`
+	Stats   *proxy.Stats `json:"stats,omitempty"`
+	proxy.Metadata
+}
+
+func encodeJSONL(w io.Writer, records []Record) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range records {
+		stats := r.Stats
+		if err := encoder.Encode(jsonRecord{
+			Proxy:    r.Proxy.URL().String(),
+			Type:     r.Proxy.Type.String(),
+			Host:     r.Proxy.Host,
+			Port:     r.Proxy.Port,
+			Segment:  r.Segment,
+			Stats:    &stats,
+			Metadata: r.Proxy.Metadata,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeJSONL(r io.Reader) ([]Record, error) {
+	var records []Record
+	decoder := json.NewDecoder(r)
+	for {
+		var jr jsonRecord
+		if err := decoder.Decode(&jr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return records, err
+		}
+
+		p, err := proxy.Parse(jr.Proxy)
+		if err != nil {
+			continue
+		}
+		p.Metadata = jr.Metadata
+		record := Record{Proxy: p, Segment: jr.Segment}
+		if jr.Stats != nil {
+			record.Stats = *jr.Stats
+		}
+		records = append(records, record)
+	}
+}
+
+var csvHeader = []string{"proxy", "type", "host", "port", "segment", "total_requests", "success_requests", "failed_requests", "latency_ms", "throughput", "last_used",
+	"source", "discovered_at", "country", "anonymity", "https", "remote_dns", "city", "asn", "as_org", "network"}
+
+func encodeCSV(w io.Writer, records []Record) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		lastUsed := ""
+		if !r.Stats.LastUsed.IsZero() {
+			lastUsed = r.Stats.LastUsed.Format(time.RFC3339)
+		}
+		discoveredAt := ""
+		if !r.Proxy.DiscoveredAt.IsZero() {
+			discoveredAt = r.Proxy.DiscoveredAt.Format(time.RFC3339)
+		}
+		anonymity := ""
+		if r.Proxy.Anonymity != proxy.AnonymityUnknown {
+			anonymity = r.Proxy.Anonymity.String()
+		}
+		if err := cw.Write([]string{
+			r.Proxy.URL().String(),
+			r.Proxy.Type.String(),
+			r.Proxy.Host,
+			strconv.Itoa(r.Proxy.Port),
+			r.Segment,
+			strconv.Itoa(r.Stats.TotalRequests),
+			strconv.Itoa(r.Stats.SuccessRequests),
+			strconv.Itoa(r.Stats.FailedRequests),
+			strconv.FormatInt(r.Stats.Latency.Milliseconds(), 10),
+			strconv.FormatFloat(r.Stats.Throughput, 'f', 0, 64),
+			lastUsed,
+			r.Proxy.Source,
+			discoveredAt,
+			r.Proxy.Country,
+			anonymity,
+			strconv.FormatBool(r.Proxy.HTTPS),
+			strconv.FormatBool(r.Proxy.RemoteDNS),
+			r.Proxy.City,
+			strconv.FormatUint(uint64(r.Proxy.ASN), 10),
+			r.Proxy.ASOrg,
+			r.Proxy.Network,
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func decodeCSV(r io.Reader) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	// Columns are looked up by header name so partial exports still load
+	columns := make(map[string]int, len(rows[0]))
+	for i, name := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["proxy"]; !ok {
+		return nil, errors.New("csv header has no proxy column")
+	}
+
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var records []Record
+	for _, row := range rows[1:] {
+		p, err := proxy.Parse(field(row, "proxy"))
+		if err != nil {
+			continue
+		}
+
+		record := Record{Proxy: p, Segment: field(row, "segment")}
+		record.Stats.TotalRequests, _ = strconv.Atoi(field(row, "total_requests"))
+		record.Stats.SuccessRequests, _ = strconv.Atoi(field(row, "success_requests"))
+		record.Stats.FailedRequests, _ = strconv.Atoi(field(row, "failed_requests"))
+		if ms, err := strconv.ParseInt(field(row, "latency_ms"), 10, 64); err == nil {
+			record.Stats.Latency = time.Duration(ms) * time.Millisecond
+		}
+		record.Stats.Throughput, _ = strconv.ParseFloat(field(row, "throughput"), 64)
+		record.Stats.LastUsed, _ = time.Parse(time.RFC3339, field(row, "last_used"))
+
+		p.Source = field(row, "source")
+		p.DiscoveredAt, _ = time.Parse(time.RFC3339, field(row, "discovered_at"))
+		p.Country = proxy.NormalizeCountry(field(row, "country"))
+		p.Anonymity = proxy.ParseAnonymity(field(row, "anonymity"))
+		p.HTTPS, _ = strconv.ParseBool(field(row, "https"))
+		p.RemoteDNS, _ = strconv.ParseBool(field(row, "remote_dns"))
+		p.City = field(row, "city")
+		if asn, err := strconv.ParseUint(field(row, "asn"), 10, 32); err == nil {
+			p.ASN = uint(asn)
+		}
+		p.ASOrg = field(row, "as_org")
+		p.Network = field(row, "network")
+		records = append(records, record)
+	}
+	return records, nil
+}
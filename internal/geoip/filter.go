@@ -0,0 +1,46 @@
+package geoip
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// Filter admits proxies by country, ASN and network type. Allow lists reject
+// proxies whose country or ASN is unknown; network types are only denied
+// when known.
+type Filter struct {
+	AllowCountries  []string
+	DenyCountries   []string
+	AllowASNs       []uint
+	DenyASNs        []uint
+	DenyDatacenter  bool
+	DenyResidential bool
+}
+
+// Empty reports whether the filter admits every proxy
+func (f *Filter) Empty() bool {
+	return len(f.AllowCountries) == 0 && len(f.DenyCountries) == 0 &&
+		len(f.AllowASNs) == 0 && len(f.DenyASNs) == 0 &&
+		!f.DenyDatacenter && !f.DenyResidential
+}
+
+// Check returns an error describing why the proxy is not admitted, or nil
+func (f *Filter) Check(m *proxy.Metadata) error {
+	switch {
+	case len(f.AllowCountries) > 0 && !slices.Contains(f.AllowCountries, m.Country):
+		return fmt.Errorf("country %q is not allowed", m.Country)
+	case m.Country != "" && slices.Contains(f.DenyCountries, m.Country):
+		return fmt.Errorf("country %q is denied", m.Country)
+	case len(f.AllowASNs) > 0 && !slices.Contains(f.AllowASNs, m.ASN):
+		return fmt.Errorf("ASN %d is not allowed", m.ASN)
+	case m.ASN != 0 && slices.Contains(f.DenyASNs, m.ASN):
+		return fmt.Errorf("ASN %d is denied", m.ASN)
+	case f.DenyDatacenter && m.Network == Datacenter:
+		return fmt.Errorf("datacenter networks are denied")
+	case f.DenyResidential && m.Network == Residential:
+		return fmt.Errorf("residential networks are denied")
+	}
+	return nil
+}
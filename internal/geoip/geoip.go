@@ -0,0 +1,123 @@
+// Package geoip enriches proxies with location and network data from local
+// MaxMind-format (.mmdb) databases such as GeoLite2-Country, GeoLite2-City,
+// GeoLite2-ASN or GeoIP2-ISP, and filters them by it.
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Network types derived from database traits
+const (
+	Datacenter  = "datacenter"
+	Residential = "residential"
+)
+
+// DB looks addresses up in one or more databases, merging what each knows
+type DB struct {
+	readers []*maxminddb.Reader
+}
+
+// record covers the fields of the country, city, ASN, ISP and anonymous IP
+// database layouts; each database fills the parts it has
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Traits struct {
+		UserType          string `maxminddb:"user_type"`
+		IsHostingProvider bool   `maxminddb:"is_hosting_provider"`
+	} `maxminddb:"traits"`
+	ASN               uint   `maxminddb:"autonomous_system_number"`
+	ASOrganization    string `maxminddb:"autonomous_system_organization"`
+	IsHostingProvider bool   `maxminddb:"is_hosting_provider"`
+}
+
+// Open loads the databases at paths into memory
+func Open(paths ...string) (*DB, error) {
+	db := &DB{}
+	for _, path := range paths {
+		// Read into memory rather than mmap so a replaced DB stays valid for lookups in flight
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("geoip database: %w", err)
+		}
+		reader, err := maxminddb.FromBytes(data)
+		if err != nil {
+			return nil, fmt.Errorf("geoip database %s: %w", path, err)
+		}
+		db.readers = append(db.readers, reader)
+	}
+	return db, nil
+}
+
+// resolveTimeout bounds the lookup of proxies given by DNS name
+const resolveTimeout = 5 * time.Second
+
+// lookupNetIP resolves proxy host names, replaced in tests
+var lookupNetIP = net.DefaultResolver.LookupNetIP
+
+// Enrich fills the proxy's location and network metadata from the databases.
+// Hosts given as DNS names are looked up by the first address they resolve to.
+func (db *DB) Enrich(p *proxy.Proxy) error {
+	ip := net.ParseIP(p.Host)
+	if ip == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		defer cancel()
+		addrs, err := lookupNetIP(ctx, "ip", p.Host)
+		if err != nil {
+			return err
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("no addresses for %s", p.Host)
+		}
+		ip = net.IP(addrs[0].Unmap().AsSlice())
+	}
+
+	for _, reader := range db.readers {
+		var r record
+		if err := reader.Lookup(ip, &r); err != nil {
+			return err
+		}
+
+		// The database country replaces the one claimed by the provider
+		if country := proxy.NormalizeCountry(r.Country.ISOCode); country != "" {
+			p.Country = country
+		}
+		if city := r.City.Names["en"]; city != "" {
+			p.City = city
+		}
+		if r.ASN != 0 {
+			p.ASN = r.ASN
+			p.ASOrg = r.ASOrganization
+		}
+		if network := networkType(&r); network != "" {
+			p.Network = network
+		}
+	}
+	return nil
+}
+
+func networkType(r *record) string {
+	if r.IsHostingProvider || r.Traits.IsHostingProvider {
+		return Datacenter
+	}
+	switch strings.ToLower(r.Traits.UserType) {
+	case "hosting", "content_delivery_network":
+		return Datacenter
+	case "residential", "cellular":
+		return Residential
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package geoip
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+// writeFixture generates a small database with the given networks
+func writeFixture(t *testing.T, dbType string, networks map[string]mmdbtype.Map) string {
+	t.Helper()
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: dbType, RecordSize: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for cidr, data := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tree.Insert(network, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), dbType+".mmdb")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := tree.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openFixture(t *testing.T) *DB {
+	city := writeFixture(t, "GeoIP2-City", map[string]mmdbtype.Map{
+		"1.2.3.0/24": {
+			"country": mmdbtype.Map{"iso_code": mmdbtype.String("DE")},
+			"city":    mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String("Berlin")}},
+			"traits":  mmdbtype.Map{"user_type": mmdbtype.String("residential")},
+		},
+		"8.8.8.0/24": {
+			"country": mmdbtype.Map{"iso_code": mmdbtype.String("US")},
+		},
+	})
+	asn := writeFixture(t, "GeoLite2-ASN", map[string]mmdbtype.Map{
+		"8.8.8.0/24": {
+			"autonomous_system_number":       mmdbtype.Uint32(15169),
+			"autonomous_system_organization": mmdbtype.String("GOOGLE"),
+		},
+	})
+	isp := writeFixture(t, "GeoIP2-Anonymous-IP", map[string]mmdbtype.Map{
+		"8.8.8.0/24": {"is_hosting_provider": mmdbtype.Bool(true)},
+	})
+
+	db, err := Open(city, asn, isp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestEnrich(t *testing.T) {
+	db := openFixture(t)
+
+	p := &proxy.Proxy{Host: "8.8.8.8", Port: 3128, Metadata: proxy.Metadata{Country: "NL"}}
+	if err := db.Enrich(p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Country != "US" || p.ASN != 15169 || p.ASOrg != "GOOGLE" || p.Network != Datacenter {
+		t.Errorf("enriched metadata: %+v", p.Metadata)
+	}
+
+	p = &proxy.Proxy{Host: "1.2.3.4", Port: 8080}
+	if err := db.Enrich(p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Country != "DE" || p.City != "Berlin" || p.ASN != 0 || p.Network != Residential {
+		t.Errorf("enriched metadata: %+v", p.Metadata)
+	}
+
+	// Unknown addresses keep the claimed country
+	p = &proxy.Proxy{Host: "9.9.9.9", Port: 80, Metadata: proxy.Metadata{Country: "CH"}}
+	if err := db.Enrich(p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Country != "CH" {
+		t.Errorf("country = %q, want the claimed one", p.Country)
+	}
+
+	// Named hosts are looked up by their address
+	lookupNetIP = func(ctx context.Context, network, host string) ([]netip.Addr, error) {
+		if host == "proxy.example.com" {
+			return []netip.Addr{netip.MustParseAddr("8.8.8.8")}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	defer func() { lookupNetIP = net.DefaultResolver.LookupNetIP }()
+	p = &proxy.Proxy{Host: "proxy.example.com", Port: 3128}
+	if err := db.Enrich(p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Country != "US" || p.ASN != 15169 {
+		t.Errorf("named host metadata: %+v", p.Metadata)
+	}
+	if err := db.Enrich(&proxy.Proxy{Host: "missing.example.com", Port: 3128}); err == nil {
+		t.Error("an unresolvable host was enriched")
+	}
+}
+
+func TestFilter(t *testing.T) {
+	db := openFixture(t)
+	google := &proxy.Proxy{Host: "8.8.8.8", Port: 3128}
+	berlin := &proxy.Proxy{Host: "1.2.3.4", Port: 8080}
+	unknown := &proxy.Proxy{Host: "9.9.9.9", Port: 80}
+	for _, p := range []*proxy.Proxy{google, berlin, unknown} {
+		if err := db.Enrich(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		admit  []bool // google, berlin, unknown
+	}{
+		{"empty", Filter{}, []bool{true, true, true}},
+		{"allow countries", Filter{AllowCountries: []string{"DE"}}, []bool{false, true, false}},
+		{"deny countries", Filter{DenyCountries: []string{"DE"}}, []bool{true, false, true}},
+		{"allow ASNs", Filter{AllowASNs: []uint{15169}}, []bool{true, false, false}},
+		{"deny ASNs", Filter{DenyASNs: []uint{15169}}, []bool{false, true, true}},
+		{"deny datacenter", Filter{DenyDatacenter: true}, []bool{false, true, true}},
+		{"deny residential", Filter{DenyResidential: true}, []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		for i, p := range []*proxy.Proxy{google, berlin, unknown} {
+			if got := tt.filter.Check(&p.Metadata) == nil; got != tt.admit[i] {
+				t.Errorf("%s: %s admitted = %t, want %t", tt.name, p, got, tt.admit[i])
+			}
+		}
+	}
+}
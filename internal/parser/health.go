@@ -0,0 +1,82 @@
+package parser
+
+import "time"
+
+const (
+	// initialYield is the validated yield assumed for providers not measured yet
+	initialYield = 0.5
+	// yieldWeight is the EWMA weight of the latest validated yield
+	yieldWeight = 0.3
+	// maxBackoff caps the delay after repeated failures, unless the interval is longer
+	maxBackoff = 1 * time.Hour
+)
+
+// Health tracks how a provider has been doing over time
+type Health struct {
+	Scrapes             int       `json:"scrapes"`
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Candidates          int       `json:"candidates"`
+	Validated           int       `json:"validated"`
+	Yield               float64   `json:"yield"`
+	LastSuccess         time.Time `json:"last_success"`
+	LastFailure         time.Time `json:"last_failure"`
+	LastError           string    `json:"last_error,omitempty"`
+	BackoffUntil        time.Time `json:"backoff_until"`
+}
+
+func newHealth() Health {
+	return Health{Yield: initialYield}
+}
+
+// recordScrape counts a scrape. Errors and empty results count as failures
+// and back the provider off exponentially from its interval.
+func (h *Health) recordScrape(result Result, interval time.Duration) {
+	now := time.Now()
+	h.Scrapes++
+
+	if result.Err == nil && len(result.Proxies) > 0 {
+		h.ConsecutiveFailures = 0
+		h.LastSuccess = now
+		h.LastError = ""
+		h.BackoffUntil = time.Time{}
+		return
+	}
+
+	h.Failures++
+	h.ConsecutiveFailures++
+	h.LastFailure = now
+	if result.Err != nil {
+		h.LastError = result.Err.Error()
+	} else {
+		h.LastError = "no proxies found"
+	}
+	h.BackoffUntil = now.Add(backoff(interval, h.ConsecutiveFailures))
+}
+
+// recordValidated folds the validated share of new candidates into the yield
+func (h *Health) recordValidated(candidates, validated int) {
+	if candidates <= 0 {
+		return
+	}
+	h.Candidates += candidates
+	h.Validated += validated
+	h.Yield = (1-yieldWeight)*h.Yield + yieldWeight*float64(validated)/float64(candidates)
+}
+
+// backoff doubles interval for every consecutive failure after the first
+func backoff(interval time.Duration, failures int) time.Duration {
+	limit := maxBackoff
+	if interval > limit {
+		limit = interval
+	}
+
+	d := interval
+	for i := 1; i < failures && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		d = limit
+	}
+	return d
+}
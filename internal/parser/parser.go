@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/aredoff/proxygun/internal/parser/providers"
 	"github.com/aredoff/proxygun/internal/proxy"
@@ -14,57 +17,223 @@ type Parser interface {
 	Name() string
 }
 
-// RotatingParser rotates providers to avoid blocking
+// RotatingParser scrapes providers concurrently on their own schedules
 type RotatingParser struct {
-	parsers    []Parser
-	currentIdx int
-	mu         sync.Mutex
-}
-
-// NewRotatingParser creates a new rotating parser
-func NewRotatingParser() *RotatingParser {
-	return &RotatingParser{
-		parsers: []Parser{
-			providers.NewSSLProxiesProvider(),
-			providers.NewUSProxyProvider(),
-			providers.NewFreeProxyListProvider(),
-			providers.NewCheckerProxyNetProvider(),
-			providers.NewGithubTheSpeedXProvider(),
-			providers.NewHideMyNameProvider(),
-			providers.NewGithubMmpx12Provider(),
-			providers.NewKuaidailiProvider(),
-		},
-		currentIdx: 0,
+	entries []*entry
+	paused  map[string]bool
+	mu      sync.Mutex
+}
+
+// entry is a provider with its schedule, scraping state and health
+type entry struct {
+	source  Source
+	next    time.Time
+	last    time.Time // Start of the last scrape
+	running bool
+	health  Health
+}
+
+// ProviderStatus describes a provider, whether it is paused, when it is
+// scraped next and how well it has been doing
+type ProviderStatus struct {
+	Name       string    `json:"name"`
+	Paused     bool      `json:"paused"`
+	Running    bool      `json:"running"`
+	NextScrape time.Time `json:"next_scrape"`
+	Health     Health    `json:"health"`
+}
+
+// DefaultParsers returns all built-in providers
+func DefaultParsers() []Parser {
+	return []Parser{
+		providers.NewSSLProxiesProvider(),
+		providers.NewUSProxyProvider(),
+		providers.NewFreeProxyListProvider(),
+		providers.NewCheckerProxyNetProvider(),
+		providers.NewGithubTheSpeedXProvider(),
+		providers.NewHideMyNameProvider(),
+		providers.NewGithubMmpx12Provider(),
+		providers.NewKuaidailiProvider(),
+	}
+}
+
+// NewRotatingParser creates a new rotating parser over the given sources
+func NewRotatingParser(sources []Source) *RotatingParser {
+	p := &RotatingParser{paused: make(map[string]bool)}
+	p.SetSources(sources)
+	return p
+}
+
+// ScrapeDue concurrently scrapes every provider whose schedule is due, or all
+// of them when force is set, skipping paused providers and those still
+// running from an earlier call or backing off after failures. Forcing never
+// scrapes a polite provider before its minimum interval. It returns one
+// result per scraped provider, best validated yield first.
+func (p *RotatingParser) ScrapeDue(ctx context.Context, force bool) []Result {
+	now := time.Now()
+
+	p.mu.Lock()
+	var due []*entry
+	for _, e := range p.entries {
+		if p.paused[e.source.Name()] || e.running || now.Before(e.health.BackoffUntil) ||
+			(!force && now.Before(e.next)) || now.Before(e.last.Add(e.source.minInterval())) {
+			continue
+		}
+		e.running = true
+		e.last = now
+		e.next = now.Add(e.source.Schedule.delay())
+		due = append(due, e)
+	}
+	p.mu.Unlock()
+
+	results := make([]Result, len(due))
+	var wg sync.WaitGroup
+	for i, e := range due {
+		wg.Add(1)
+		go func(i int, e *entry) {
+			defer wg.Done()
+			results[i] = p.scrape(ctx, e)
+		}(i, e)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	for i, e := range due {
+		e.health.recordScrape(results[i], e.source.Schedule.Interval)
 	}
+	// Sort by yield so the best providers' candidates are validated first
+	order := make([]int, len(due))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return due[order[i]].health.Yield > due[order[j]].health.Yield
+	})
+	p.mu.Unlock()
+
+	sorted := make([]Result, 0, len(results))
+	for _, i := range order {
+		sorted = append(sorted, results[i])
+	}
+	return sorted
 }
 
-// ParseNext parses the next provider in rotation
-func (p *RotatingParser) Next() ([]*proxy.Proxy, error) {
+// RecordValidated adds how many of a provider's new candidates passed validation
+func (p *RotatingParser) RecordValidated(name string, candidates, validated int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if len(p.parsers) == 0 {
-		return nil, fmt.Errorf("no parsers available")
+	for _, e := range p.entries {
+		if e.source.Name() == name {
+			e.health.recordValidated(candidates, validated)
+			return
+		}
+	}
+}
+
+// scrape runs one provider until it finishes or its timeout expires. Parse
+// takes no context, so a timed out provider keeps running in the background
+// and is not scheduled again until it returns.
+func (p *RotatingParser) scrape(ctx context.Context, e *entry) Result {
+	start := time.Now()
+	if timeout := e.source.Schedule.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
 
-	parser := p.parsers[p.currentIdx]
-	p.currentIdx = (p.currentIdx + 1) % len(p.parsers)
+	done := make(chan Result, 1)
+	go func() {
+		proxies, err := e.source.Parse()
+		p.mu.Lock()
+		e.running = false
+		p.mu.Unlock()
+		done <- Result{Proxies: proxies, Err: err}
+	}()
 
-	return parser.Parse()
+	var result Result
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result.Err = fmt.Errorf("scrape abandoned: %w", ctx.Err())
+	}
+
+	// Every proxy records where and when it was found
+	for _, px := range result.Proxies {
+		if px.Source == "" {
+			px.Source = e.source.Name()
+		}
+		if px.DiscoveredAt.IsZero() {
+			px.DiscoveredAt = start
+		}
+	}
+	result.Provider = e.source.Name()
+	result.Duration = time.Since(start)
+	return result
 }
 
-// GetCurrentProviderName returns the name of current provider
-func (p *RotatingParser) GetCurrentProviderName() string {
+// SetSources replaces the providers in rotation. Providers that stay in the
+// set keep their paused state and next scrape time.
+func (p *RotatingParser) SetSources(sources []Source) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if len(p.parsers) == 0 {
-		return "none"
+	old := make(map[string]*entry, len(p.entries))
+	for _, e := range p.entries {
+		old[e.source.Name()] = e
 	}
 
-	// Get the name of previous provider (which was used)
-	prevIdx := (p.currentIdx - 1 + len(p.parsers)) % len(p.parsers)
-	return p.parsers[prevIdx].Name()
+	entries := make([]*entry, 0, len(sources))
+	paused := make(map[string]bool)
+	for _, source := range sources {
+		e := &entry{source: source, health: newHealth()}
+		if prev, ok := old[source.Name()]; ok {
+			e.next, e.last, e.running, e.health = prev.next, prev.last, prev.running, prev.health
+		}
+		entries = append(entries, e)
+		if p.paused[source.Name()] {
+			paused[source.Name()] = true
+		}
+	}
+	p.entries = entries
+	p.paused = paused
+}
+
+// SetPaused pauses or resumes the provider with the given name
+func (p *RotatingParser) SetPaused(name string, paused bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range p.entries {
+		if e.source.Name() == name {
+			if paused {
+				p.paused[name] = true
+			} else {
+				delete(p.paused, name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown provider %q", name)
+}
+
+// Providers returns the status of every provider in rotation order
+func (p *RotatingParser) Providers() []ProviderStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]ProviderStatus, 0, len(p.entries))
+	for _, e := range p.entries {
+		name := e.source.Name()
+		statuses = append(statuses, ProviderStatus{
+			Name:       name,
+			Paused:     p.paused[name],
+			Running:    e.running,
+			NextScrape: e.next,
+			Health:     e.health,
+		})
+	}
+	return statuses
 }
 
 // MultiParser combines multiple specialized providers (for compatibility)
@@ -73,22 +242,33 @@ type MultiParser struct {
 }
 
 // NewMultiParser creates a new multi-parser with provider rotation
-func NewMultiParser() *MultiParser {
+func NewMultiParser(sources []Source) *MultiParser {
 	return &MultiParser{
-		rotatingParser: NewRotatingParser(),
+		rotatingParser: NewRotatingParser(sources),
 	}
 }
 
-// ParseAll performs parsing of one provider (with rotation)
-func (p *MultiParser) Parse() ([]*proxy.Proxy, []error) {
-	proxies, err := p.rotatingParser.Next()
-	if err != nil {
-		return nil, []error{err}
-	}
-	return proxies, nil
+// ScrapeDue concurrently scrapes the providers whose schedule is due
+func (p *MultiParser) ScrapeDue(ctx context.Context, force bool) []Result {
+	return p.rotatingParser.ScrapeDue(ctx, force)
+}
+
+// RecordValidated adds how many of a provider's new candidates passed validation
+func (p *MultiParser) RecordValidated(name string, candidates, validated int) {
+	p.rotatingParser.RecordValidated(name, candidates, validated)
+}
+
+// SetSources replaces the providers in rotation
+func (p *MultiParser) SetSources(sources []Source) {
+	p.rotatingParser.SetSources(sources)
+}
+
+// SetPaused pauses or resumes the provider with the given name
+func (p *MultiParser) SetPaused(name string, paused bool) error {
+	return p.rotatingParser.SetPaused(name, paused)
 }
 
-// GetCurrentProviderName returns the name of current provider
-func (p *MultiParser) GetCurrentProviderName() string {
-	return p.rotatingParser.GetCurrentProviderName()
+// Providers returns the status of every provider
+func (p *MultiParser) Providers() []ProviderStatus {
+	return p.rotatingParser.Providers()
 }
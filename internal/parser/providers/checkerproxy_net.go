@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/aredoff/proxygun/internal/proxy"
@@ -67,29 +65,13 @@ func (p *CheckerProxyNetProvider) Parse() ([]*proxy.Proxy, error) {
 
 	var proxies []*proxy.Proxy
 	for _, proxyStr := range response.Data.ProxyList {
-		parts := strings.Split(proxyStr, ":")
-		if len(parts) != 2 {
-			continue
-		}
-
-		host := strings.TrimSpace(parts[0])
-		portStr := strings.TrimSpace(parts[1])
-
-		if !isValidIP(host) || !isValidPort(portStr) {
-			continue
-		}
-
-		port, err := strconv.Atoi(portStr)
-		if err != nil {
+		px, ok := parseCandidate(proxyStr, proxy.HTTP)
+		if !ok {
 			continue
 		}
 
 		// Use HTTP as default type, will be detected during validation
-		proxies = append(proxies, &proxy.Proxy{
-			Host: host,
-			Port: port,
-			Type: proxy.HTTP,
-		})
+		proxies = append(proxies, px)
 	}
 
 	return proxies, nil
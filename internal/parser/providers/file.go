@@ -0,0 +1,47 @@
+package providers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aredoff/proxygun/internal/format"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// FileProvider reads proxies from a local list in any supported export format
+type FileProvider struct {
+	path   string
+	format format.Format
+}
+
+// NewFileProvider creates a provider for path, detecting the format from its extension
+func NewFileProvider(path string) *FileProvider {
+	return &FileProvider{
+		path:   path,
+		format: format.Detect(path),
+	}
+}
+
+func (p *FileProvider) Name() string {
+	return fmt.Sprintf("File(%s)", filepath.Base(p.path))
+}
+
+func (p *FileProvider) Parse() ([]*proxy.Proxy, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records, err := format.Decode(f, p.format)
+	if err != nil {
+		return nil, err
+	}
+
+	proxies := make([]*proxy.Proxy, 0, len(records))
+	for _, r := range records {
+		proxies = append(proxies, r.Proxy)
+	}
+	return proxies, nil
+}
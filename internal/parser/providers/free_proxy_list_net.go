@@ -2,8 +2,6 @@ package providers
 
 import (
 	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -50,37 +48,6 @@ func (p *SSLProxiesProvider) Parse() ([]*proxy.Proxy, error) {
 		return nil, err
 	}
 
-	var proxies []*proxy.Proxy
-
 	// Look for proxy table - may have different selectors
-	doc.Find("table tbody tr").Each(func(i int, s *goquery.Selection) {
-		tds := s.Find("td")
-		if tds.Length() >= 7 { // SSL Proxies usually has 8 columns
-			host := strings.TrimSpace(tds.Eq(0).Text())
-			portStr := strings.TrimSpace(tds.Eq(1).Text())
-			httpsSupport := strings.TrimSpace(tds.Eq(6).Text()) // HTTPS column
-
-			if host == "" || portStr == "" {
-				return
-			}
-
-			port, err := strconv.Atoi(portStr)
-			if err != nil || port <= 0 {
-				return
-			}
-
-			proxyType := proxy.HTTP
-			if strings.ToLower(httpsSupport) == "yes" {
-				proxyType = proxy.HTTP // HTTPS is also HTTP proxy
-			}
-
-			proxies = append(proxies, &proxy.Proxy{
-				Host: host,
-				Port: port,
-				Type: proxyType,
-			})
-		}
-	})
-
-	return proxies, nil
+	return parseProxyListRows(doc.Find("table tbody tr")), nil
 }
@@ -2,7 +2,6 @@ package providers
 
 import (
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -50,37 +49,8 @@ func (p *FreeProxyListProvider) Parse() ([]*proxy.Proxy, error) {
 		return nil, err
 	}
 
-	var proxies []*proxy.Proxy
-
 	// Free Proxy List uses id="proxylisttable"
-	doc.Find("#proxylisttable tbody tr").Each(func(i int, s *goquery.Selection) {
-		tds := s.Find("td")
-		if tds.Length() >= 7 {
-			host := strings.TrimSpace(tds.Eq(0).Text())
-			portStr := strings.TrimSpace(tds.Eq(1).Text())
-			httpsSupport := strings.TrimSpace(tds.Eq(6).Text())
-
-			if host == "" || portStr == "" {
-				return
-			}
-
-			port, err := strconv.Atoi(portStr)
-			if err != nil || port <= 0 {
-				return
-			}
-
-			proxyType := proxy.HTTP
-			if strings.ToLower(httpsSupport) == "yes" {
-				proxyType = proxy.HTTP
-			}
-
-			proxies = append(proxies, &proxy.Proxy{
-				Host: host,
-				Port: port,
-				Type: proxyType,
-			})
-		}
-	})
+	proxies := parseProxyListRows(doc.Find("#proxylisttable tbody tr"))
 
 	// Additionally search in other possible tables
 	if len(proxies) == 0 {
@@ -90,13 +60,8 @@ func (p *FreeProxyListProvider) Parse() ([]*proxy.Proxy, error) {
 				host := strings.TrimSpace(tds.Eq(0).Text())
 				portStr := strings.TrimSpace(tds.Eq(1).Text())
 
-				if isValidIP(host) && isValidPort(portStr) {
-					port, _ := strconv.Atoi(portStr)
-					proxies = append(proxies, &proxy.Proxy{
-						Host: host,
-						Port: port,
-						Type: proxy.HTTP,
-					})
+				if px, ok := newCandidate(host, portStr, proxy.HTTP); ok {
+					proxies = append(proxies, px)
 				}
 			}
 		})
@@ -104,3 +69,30 @@ func (p *FreeProxyListProvider) Parse() ([]*proxy.Proxy, error) {
 
 	return proxies, nil
 }
+
+// parseProxyListRows reads the table layout shared by free-proxy-list.net and
+// its sister sites: IP, port, country code, country, anonymity, Google, HTTPS
+// and last checked
+func parseProxyListRows(rows *goquery.Selection) []*proxy.Proxy {
+	var proxies []*proxy.Proxy
+	rows.Each(func(i int, s *goquery.Selection) {
+		tds := s.Find("td")
+		if tds.Length() < 7 {
+			return
+		}
+		host := strings.TrimSpace(tds.Eq(0).Text())
+		portStr := strings.TrimSpace(tds.Eq(1).Text())
+
+		px, ok := newCandidate(host, portStr, proxy.HTTP) // HTTPS is also HTTP proxy
+		if !ok {
+			return
+		}
+		px.Metadata = proxy.Metadata{
+			Country:   proxy.NormalizeCountry(tds.Eq(2).Text()),
+			Anonymity: proxy.ParseAnonymity(tds.Eq(4).Text()),
+			HTTPS:     strings.EqualFold(strings.TrimSpace(tds.Eq(6).Text()), "yes"),
+		}
+		proxies = append(proxies, px)
+	})
+	return proxies
+}
@@ -3,7 +3,6 @@ package providers
 import (
 	"bufio"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -35,15 +34,16 @@ func (p *GithubMmpx12Provider) Parse() ([]*proxy.Proxy, error) {
 	urls := []struct {
 		url       string
 		proxyType proxy.Type
+		https     bool
 	}{
-		{"https://raw.githubusercontent.com/mmpx12/proxy-list/master/http.txt", proxy.HTTP},
-		{"https://raw.githubusercontent.com/mmpx12/proxy-list/master/https.txt", proxy.HTTP},
-		{"https://raw.githubusercontent.com/mmpx12/proxy-list/master/socks4.txt", proxy.SOCKS4},
-		{"https://raw.githubusercontent.com/mmpx12/proxy-list/master/socks5.txt", proxy.SOCKS5},
+		{"https://raw.githubusercontent.com/mmpx12/proxy-list/master/http.txt", proxy.HTTP, false},
+		{"https://raw.githubusercontent.com/mmpx12/proxy-list/master/https.txt", proxy.HTTP, true},
+		{"https://raw.githubusercontent.com/mmpx12/proxy-list/master/socks4.txt", proxy.SOCKS4, false},
+		{"https://raw.githubusercontent.com/mmpx12/proxy-list/master/socks5.txt", proxy.SOCKS5, false},
 	}
 
 	for _, urlInfo := range urls {
-		proxies, err := p.parseURL(urlInfo.url, urlInfo.proxyType)
+		proxies, err := p.parseURL(urlInfo.url, urlInfo.proxyType, urlInfo.https)
 		if err != nil {
 			continue
 		}
@@ -53,7 +53,7 @@ func (p *GithubMmpx12Provider) Parse() ([]*proxy.Proxy, error) {
 	return allProxies, nil
 }
 
-func (p *GithubMmpx12Provider) parseURL(url string, proxyType proxy.Type) ([]*proxy.Proxy, error) {
+func (p *GithubMmpx12Provider) parseURL(url string, proxyType proxy.Type, https bool) ([]*proxy.Proxy, error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
@@ -76,28 +76,12 @@ func (p *GithubMmpx12Provider) parseURL(url string, proxyType proxy.Type) ([]*pr
 			continue
 		}
 
-		parts := strings.Split(line, ":")
-		if len(parts) != 2 {
+		px, ok := parseCandidate(line, proxyType)
+		if !ok {
 			continue
 		}
-
-		host := strings.TrimSpace(parts[0])
-		portStr := strings.TrimSpace(parts[1])
-
-		if !isValidIP(host) || !isValidPort(portStr) {
-			continue
-		}
-
-		port, err := strconv.Atoi(portStr)
-		if err != nil {
-			continue
-		}
-
-		proxies = append(proxies, &proxy.Proxy{
-			Host: host,
-			Port: port,
-			Type: proxyType,
-		})
+		px.HTTPS = https
+		proxies = append(proxies, px)
 	}
 
 	return proxies, scanner.Err()
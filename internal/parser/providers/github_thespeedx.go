@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -32,6 +31,11 @@ func NewGithubTheSpeedXProvider() *GithubTheSpeedXProvider {
 	}
 }
 
+// SetURLs replaces the list files that are scraped
+func (p *GithubTheSpeedXProvider) SetURLs(urls []string) {
+	p.urls = urls
+}
+
 func (p *GithubTheSpeedXProvider) Name() string {
 	return "GithubTheSpeedX"
 }
@@ -77,29 +81,13 @@ func (p *GithubTheSpeedXProvider) parseURL(url string) ([]*proxy.Proxy, error) {
 			continue
 		}
 
-		parts := strings.Split(line, ":")
-		if len(parts) != 2 {
-			continue
-		}
-
-		host := strings.TrimSpace(parts[0])
-		portStr := strings.TrimSpace(parts[1])
-
-		if !isValidIP(host) || !isValidPort(portStr) {
-			continue
-		}
-
-		port, err := strconv.Atoi(portStr)
-		if err != nil {
+		px, ok := parseCandidate(line, proxy.HTTP)
+		if !ok {
 			continue
 		}
 
 		// Use HTTP as default type, will be detected during validation
-		proxies = append(proxies, &proxy.Proxy{
-			Host: host,
-			Port: port,
-			Type: proxy.HTTP,
-		})
+		proxies = append(proxies, px)
 	}
 
 	return proxies, scanner.Err()
@@ -2,7 +2,6 @@ package providers
 
 import (
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -49,36 +48,33 @@ func (p *HideMyNameProvider) Parse() ([]*proxy.Proxy, error) {
 		return nil, err
 	}
 
-	var proxies []*proxy.Proxy
-
 	// Parse proxy table rows
-	doc.Find("table tbody tr, .proxy-list tr, .table tbody tr").Each(func(i int, s *goquery.Selection) {
+	return parseHideMyNameRows(doc.Find("table tbody tr, .proxy-list tr, .table tbody tr")), nil
+}
+
+// parseHideMyNameRows reads the proxy table of hide-my-name.site: IP, port,
+// country and city, speed, types, anonymity and last checked
+func parseHideMyNameRows(rows *goquery.Selection) []*proxy.Proxy {
+	var proxies []*proxy.Proxy
+	rows.Each(func(i int, s *goquery.Selection) {
 		tds := s.Find("td")
 		if tds.Length() >= 2 {
 			host := strings.TrimSpace(tds.Eq(0).Text())
 			portStr := strings.TrimSpace(tds.Eq(1).Text())
 
-			if host == "" || portStr == "" {
+			px, ok := newCandidate(host, portStr, proxy.HTTP)
+			if !ok {
 				return
 			}
 
-			if !isValidIP(host) || !isValidPort(portStr) {
-				return
-			}
-
-			port, err := strconv.Atoi(portStr)
-			if err != nil || port <= 0 {
-				return
+			if tds.Length() >= 6 {
+				px.HTTPS = strings.Contains(strings.ToUpper(tds.Eq(4).Text()), "HTTPS")
+				px.Anonymity = proxy.ParseAnonymity(tds.Eq(5).Text())
 			}
 
 			// Use HTTP as default type, will be detected during validation
-			proxies = append(proxies, &proxy.Proxy{
-				Host: host,
-				Port: port,
-				Type: proxy.HTTP,
-			})
+			proxies = append(proxies, px)
 		}
 	})
-
-	return proxies, nil
+	return proxies
 }
@@ -3,7 +3,6 @@ package providers
 import (
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -11,8 +10,16 @@ import (
 	"github.com/aredoff/proxygun/internal/proxy"
 )
 
+// Kuaidaili answers bursts with captchas, so pages are fetched slowly and the
+// site is scraped at most every kuaidailiMinInterval
+const (
+	kuaidailiPageDelay   = 2 * time.Second
+	kuaidailiMinInterval = 10 * time.Minute
+)
+
 type KuaidailiProvider struct {
 	client *http.Client
+	pages  int
 }
 
 func NewKuaidailiProvider() *KuaidailiProvider {
@@ -23,17 +30,31 @@ func NewKuaidailiProvider() *KuaidailiProvider {
 				DisableKeepAlives: true,
 			},
 		},
+		pages: 3,
 	}
 }
 
+// SetPages sets how many list pages are scraped per run
+func (p *KuaidailiProvider) SetPages(pages int) {
+	p.pages = pages
+}
+
 func (p *KuaidailiProvider) Name() string {
 	return "Kuaidaili"
 }
 
+// MinInterval returns the shortest allowed time between scrapes
+func (p *KuaidailiProvider) MinInterval() time.Duration {
+	return kuaidailiMinInterval
+}
+
 func (p *KuaidailiProvider) Parse() ([]*proxy.Proxy, error) {
 	var allProxies []*proxy.Proxy
 
-	for page := 1; page <= 3; page++ {
+	for page := 1; page <= p.pages; page++ {
+		if page > 1 {
+			time.Sleep(kuaidailiPageDelay)
+		}
 		proxies, err := p.parsePage(page)
 		if err != nil {
 			continue
@@ -66,24 +87,21 @@ func (p *KuaidailiProvider) parsePage(page int) ([]*proxy.Proxy, error) {
 		return nil, err
 	}
 
-	var proxies []*proxy.Proxy
+	return parseKuaidailiRows(doc.Find("#list table tbody tr")), nil
+}
 
-	doc.Find("#list table tbody tr").Each(func(i int, s *goquery.Selection) {
+// parseKuaidailiRows reads the free list table of kuaidaili.com: IP, port,
+// anonymity and type
+func parseKuaidailiRows(rows *goquery.Selection) []*proxy.Proxy {
+	var proxies []*proxy.Proxy
+	rows.Each(func(i int, s *goquery.Selection) {
 		tds := s.Find("td")
 		if tds.Length() >= 4 {
 			host := strings.TrimSpace(tds.Eq(0).Text())
 			portStr := strings.TrimSpace(tds.Eq(1).Text())
+			anonymity := proxy.ParseAnonymity(tds.Eq(2).Text())
 			typeStr := strings.TrimSpace(tds.Eq(3).Text())
 
-			if host == "" || portStr == "" {
-				return
-			}
-
-			port, err := strconv.Atoi(portStr)
-			if err != nil || port <= 0 {
-				return
-			}
-
 			var proxyType proxy.Type
 			switch strings.ToUpper(typeStr) {
 			case "HTTP", "HTTPS":
@@ -96,15 +114,16 @@ func (p *KuaidailiProvider) parsePage(page int) ([]*proxy.Proxy, error) {
 				proxyType = proxy.HTTP
 			}
 
-			if isValidIP(host) && isValidPort(portStr) {
-				proxies = append(proxies, &proxy.Proxy{
-					Host: host,
-					Port: port,
-					Type: proxyType,
-				})
+			if px, ok := newCandidate(host, portStr, proxyType); ok {
+				px.Metadata = proxy.Metadata{
+					Country:   "CN", // The inha list only has mainland China proxies
+					Anonymity: anonymity,
+					HTTPS:     strings.EqualFold(typeStr, "HTTPS"),
+				}
+				proxies = append(proxies, px)
 			}
 		}
 	})
 
-	return proxies, nil
+	return proxies
 }
@@ -0,0 +1,142 @@
+package providers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestParseAnonymity(t *testing.T) {
+	// Labels as the list sites print them
+	tests := []struct {
+		label string
+		want  proxy.Anonymity
+	}{
+		{"elite proxy", proxy.Elite},
+		{"Elite Proxy", proxy.Elite},
+		{"High", proxy.Elite},
+		{"高匿名", proxy.Elite},
+		{"anonymous", proxy.Anonymous},
+		{" Anonymous ", proxy.Anonymous},
+		{"Average", proxy.Anonymous},
+		{"Low", proxy.Anonymous},
+		{"匿名", proxy.Anonymous},
+		{"transparent", proxy.Transparent},
+		{"TRANSPARENT", proxy.Transparent},
+		{"no", proxy.Transparent},
+		{"No", proxy.Transparent},
+		{"透明", proxy.Transparent},
+		{"", proxy.AnonymityUnknown},
+		{"unknown", proxy.AnonymityUnknown},
+	}
+	for _, test := range tests {
+		if got := proxy.ParseAnonymity(test.label); got != test.want {
+			t.Errorf("ParseAnonymity(%q) = %v, want %v", test.label, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeCountry(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // empty when the value is not a country code
+	}{
+		{"US", "US"},
+		{"us", "US"},
+		{"De", "DE"},
+		{" gB ", "GB"},
+		{"", ""},
+		{"USA", ""},
+		{"United States", ""},
+		{"germany", ""},
+		{"U1", ""},
+		{"Россия", ""},
+	}
+	for _, test := range tests {
+		if got := proxy.NormalizeCountry(test.in); got != test.want {
+			t.Errorf("NormalizeCountry(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+// rows parses the rows of an HTML table body
+func rows(t *testing.T, tbody string) *goquery.Selection {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<table><tbody>" + tbody + "</tbody></table>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc.Find("tbody tr")
+}
+
+func TestParseRowsMetadata(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(*goquery.Selection) []*proxy.Proxy
+		tbody string
+		want  []proxy.Proxy // Only the address, type and metadata are compared
+	}{
+		{
+			name:  "free-proxy-list",
+			parse: parseProxyListRows,
+			tbody: `<tr><td>1.2.3.4</td><td>8080</td><td>us</td><td>United States</td><td>elite proxy</td><td>no</td><td>Yes</td><td>1 min ago</td></tr>
+				<tr><td>5.6.7.8</td><td>3128</td><td>De</td><td>Germany</td><td>anonymous</td><td>no</td><td>no</td><td>1 min ago</td></tr>
+				<tr><td>9.9.9.9</td><td>80</td><td></td><td>Unknown</td><td>transparent</td><td>no</td><td>yes</td><td>1 min ago</td></tr>
+				<tr><td>1.1.1.1</td><td>80</td><td>US</td></tr>
+				<tr><td>2.2.2.2</td><td>080</td><td>gb</td><td>United Kingdom</td><td>Elite Proxy</td><td>no</td><td>YES</td><td>1 min ago</td></tr>
+				<tr><td>3.3.3.3</td><td>0</td><td>US</td><td>United States</td><td>elite proxy</td><td>no</td><td>yes</td><td>1 min ago</td></tr>`,
+			want: []proxy.Proxy{
+				{Host: "1.2.3.4", Port: 8080, Type: proxy.HTTP, Metadata: proxy.Metadata{Country: "US", Anonymity: proxy.Elite, HTTPS: true}},
+				{Host: "5.6.7.8", Port: 3128, Type: proxy.HTTP, Metadata: proxy.Metadata{Country: "DE", Anonymity: proxy.Anonymous}},
+				{Host: "9.9.9.9", Port: 80, Type: proxy.HTTP, Metadata: proxy.Metadata{Anonymity: proxy.Transparent, HTTPS: true}},
+				{Host: "2.2.2.2", Port: 80, Type: proxy.HTTP, Metadata: proxy.Metadata{Country: "GB", Anonymity: proxy.Elite, HTTPS: true}},
+			},
+		},
+		{
+			name:  "hide-my-name",
+			parse: parseHideMyNameRows,
+			tbody: `<tr><td>1.2.3.4</td><td>8080</td><td>Brazil Sao Paulo</td><td>500 ms</td><td>HTTP, HTTPS</td><td>High</td><td>1 min</td></tr>
+				<tr><td>5.6.7.8</td><td>1080</td><td>France</td><td>900 ms</td><td>SOCKS5</td><td>Average</td><td>2 min</td></tr>
+				<tr><td>6.6.6.6</td><td>80</td><td>Spain</td><td>100 ms</td><td>http</td><td>Low</td><td>3 min</td></tr>
+				<tr><td>7.7.7.7</td><td>3128</td><td>Italy</td><td>100 ms</td><td>HTTP</td><td>no</td><td>4 min</td></tr>
+				<tr><td>8.8.8.8</td><td>3128</td></tr>`,
+			want: []proxy.Proxy{
+				{Host: "1.2.3.4", Port: 8080, Type: proxy.HTTP, Metadata: proxy.Metadata{Anonymity: proxy.Elite, HTTPS: true}},
+				{Host: "5.6.7.8", Port: 1080, Type: proxy.HTTP, Metadata: proxy.Metadata{Anonymity: proxy.Anonymous}},
+				{Host: "6.6.6.6", Port: 80, Type: proxy.HTTP, Metadata: proxy.Metadata{Anonymity: proxy.Anonymous}},
+				{Host: "7.7.7.7", Port: 3128, Type: proxy.HTTP, Metadata: proxy.Metadata{Anonymity: proxy.Transparent}},
+				{Host: "8.8.8.8", Port: 3128, Type: proxy.HTTP},
+			},
+		},
+		{
+			name:  "kuaidaili",
+			parse: parseKuaidailiRows,
+			tbody: `<tr><td>1.2.3.4</td><td>8080</td><td>高匿名</td><td>HTTPS</td></tr>
+				<tr><td>5.6.7.8</td><td>1080</td><td>透明</td><td>socks5</td></tr>
+				<tr><td>6.6.6.6</td><td>80</td><td>匿名</td><td>http</td></tr>
+				<tr><td>7.7.7.7</td><td>65536</td><td>高匿名</td><td>HTTP</td></tr>`,
+			want: []proxy.Proxy{
+				{Host: "1.2.3.4", Port: 8080, Type: proxy.HTTP, Metadata: proxy.Metadata{Country: "CN", Anonymity: proxy.Elite, HTTPS: true}},
+				{Host: "5.6.7.8", Port: 1080, Type: proxy.SOCKS5, Metadata: proxy.Metadata{Country: "CN", Anonymity: proxy.Transparent}},
+				{Host: "6.6.6.6", Port: 80, Type: proxy.HTTP, Metadata: proxy.Metadata{Country: "CN", Anonymity: proxy.Anonymous}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.parse(rows(t, test.tbody))
+			if len(got) != len(test.want) {
+				t.Fatalf("parsed %d proxies, want %d: %v", len(got), len(test.want), got)
+			}
+			for i, p := range got {
+				want := test.want[i]
+				if p.Host != want.Host || p.Port != want.Port || p.Type != want.Type || p.Metadata != want.Metadata {
+					t.Errorf("row %d parsed as %+v, want %+v", i, *p, want)
+				}
+			}
+		})
+	}
+}
@@ -1,30 +1,38 @@
 package providers
 
 import (
-	"regexp"
-	"strconv"
+	"net"
 	"strings"
+
+	"github.com/aredoff/proxygun/internal/proxy"
 )
 
-// isValidIP checks IP address validity
-func isValidIP(ip string) bool {
-	re := regexp.MustCompile(`^(\d{1,3}\.){3}\d{1,3}$`)
-	if !re.MatchString(ip) {
-		return false
+// parseCandidate reads a host:port entry of a proxy list. The host may be an
+// IPv4 address, a bracketed IPv6 address or a DNS name; malformed entries
+// are reported as not ok. Entries written as URLs, such as https://host:port,
+// get the type of their scheme instead of proxyType.
+func parseCandidate(entry string, proxyType proxy.Type) (*proxy.Proxy, bool) {
+	if strings.Contains(entry, "://") {
+		p, err := proxy.Parse(entry)
+		return p, err == nil
 	}
-
-	parts := strings.Split(ip, ".")
-	for _, part := range parts {
-		num, err := strconv.Atoi(part)
-		if err != nil || num < 0 || num > 255 {
-			return false
-		}
+	host, port, err := proxy.ParseHostPort(entry)
+	if err != nil {
+		return nil, false
 	}
-	return true
+	return &proxy.Proxy{Host: host, Port: port, Type: proxyType}, true
 }
 
-// isValidPort checks port validity
-func isValidPort(portStr string) bool {
-	port, err := strconv.Atoi(portStr)
-	return err == nil && port > 0 && port <= 65535
+// newCandidate builds a proxy from the host and port columns of a proxy
+// table, accepting the same hosts as parseCandidate with or without brackets
+func newCandidate(host, portStr string, proxyType proxy.Type) (*proxy.Proxy, bool) {
+	return parseCandidate(net.JoinHostPort(trimBrackets(host), portStr), proxyType)
+}
+
+// trimBrackets removes the brackets around an IPv6 host
+func trimBrackets(host string) string {
+	if len(host) > 1 && host[0] == '[' && host[len(host)-1] == ']' {
+		return host[1 : len(host)-1]
+	}
+	return host
 }
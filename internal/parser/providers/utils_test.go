@@ -2,98 +2,62 @@ package providers
 
 import (
 	"testing"
-)
-
-func TestIsValidIP(t *testing.T) {
-	tests := []struct {
-		ip    string
-		valid bool
-	}{
-		{"192.168.1.1", true},
-		{"10.0.0.1", true},
-		{"172.16.0.1", true},
-		{"203.0.113.1", true},
-		{"255.255.255.255", true},
-		{"0.0.0.0", true},
-		{"256.1.1.1", false},       // > 255
-		{"192.168.1", false},       // не хватает октета
-		{"192.168.1.1.1", false},   // слишком много октетов
-		{"", false},                // пустая строка
-		{"abc.def.ghi.jkl", false}, // не числа
-		{"192.168.-1.1", false},    // отрицательное число
-		{"192.168.1.01", true},     // ведущий ноль (допустимо)
-	}
 
-	for _, test := range tests {
-		t.Run(test.ip, func(t *testing.T) {
-			result := isValidIP(test.ip)
-			if result != test.valid {
-				t.Errorf("isValidIP(%q) = %v, want %v", test.ip, result, test.valid)
-			}
-		})
-	}
-}
+	"github.com/aredoff/proxygun/internal/proxy"
+)
 
-func TestIsValidPort(t *testing.T) {
+func TestParseCandidate(t *testing.T) {
 	tests := []struct {
-		port  string
-		valid bool
+		entry string
+		want  string // proxy key, empty when the entry is rejected
 	}{
-		{"80", true},
-		{"443", true},
-		{"8080", true},
-		{"3128", true},
-		{"65535", true},  // максимальный порт
-		{"1", true},      // минимальный порт
-		{"0", false},     // неверный порт
-		{"65536", false}, // слишком большой
-		{"-1", false},    // отрицательный
-		{"", false},      // пустая строка
-		{"abc", false},   // не число
-		{"80.5", false},  // дробное число
-		{"080", true},    // с ведущим нулем (должно работать)
+		{"192.168.1.1:8080", "192.168.1.1:8080"},
+		{" 10.0.0.01:3128 ", "10.0.0.1:3128"},
+		{"[2001:DB8:0::1]:8080", "[2001:db8::1]:8080"},
+		{"[::ffff:1.2.3.4]:1080", "1.2.3.4:1080"},
+		{"Proxy.Example.com:3128", "proxy.example.com:3128"},
+		{"2001:db8::1:8080", ""}, // IPv6 needs brackets to separate the port
+		{"256.1.1.1:80", ""},
+		{"1.2.3.4:0", ""},
+		{"-bad-.example:80", ""},
+		{"1.2.3.4", ""},
+		{"1.2.3.4:1", "1.2.3.4:1"},
+		{"1.2.3.4:65535", "1.2.3.4:65535"},
+		{"1.2.3.4:65536", ""},
+		{"1.2.3.4:080", "1.2.3.4:80"},
+		{"1.2.3.4:-1", ""},
+		{"1.2.3.4:80.5", ""},
+		{"1.2.3.4:abc", ""},
+		{"0.0.0.0:80", "0.0.0.0:80"},
+		{"255.255.255.255:80", "255.255.255.255:80"},
+		{"192.168.-1.1:80", ""},
+		{"192.168.1.300:80", ""},
+		{"1.2.3.4.5:80", ""},
+		{"[2001:db8::g]:80", ""},
+		{"", ""},
+		{"   ", ""},
+		{":", ""},
+		{":8080", ""},
+		{"1.2.3.4:", ""},
+		{"[]:8080", ""},
 	}
 
 	for _, test := range tests {
-		t.Run(test.port, func(t *testing.T) {
-			result := isValidPort(test.port)
-			if result != test.valid {
-				t.Errorf("isValidPort(%q) = %v, want %v", test.port, result, test.valid)
+		t.Run(test.entry, func(t *testing.T) {
+			p, ok := parseCandidate(test.entry, proxy.HTTP)
+			if ok != (test.want != "") || ok && p.String() != test.want {
+				t.Errorf("parseCandidate(%q) = %v, %v, want %q", test.entry, p, ok, test.want)
 			}
 		})
 	}
-}
-
-// BenchmarkIsValidIP бенчмарк для функции валидации IP
-func BenchmarkIsValidIP(b *testing.B) {
-	testIPs := []string{
-		"192.168.1.1",
-		"10.0.0.1",
-		"256.1.1.1",       // invalid
-		"abc.def.ghi.jkl", // invalid
-	}
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		for _, ip := range testIPs {
-			isValidIP(ip)
-		}
-	}
-}
 
-// BenchmarkIsValidPort бенчмарк для функции валидации порта
-func BenchmarkIsValidPort(b *testing.B) {
-	testPorts := []string{
-		"80",
-		"8080",
-		"65536", // invalid
-		"abc",   // invalid
+	p, ok := parseCandidate("https://[2001:db8::1]:443", proxy.HTTP)
+	if !ok || p.Type != proxy.HTTPS || p.String() != "[2001:db8::1]:443" {
+		t.Errorf("parseCandidate with an https URL = %v, %v", p, ok)
 	}
 
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		for _, port := range testPorts {
-			isValidPort(port)
-		}
+	p, ok = newCandidate("2001:db8::1", "8080", proxy.SOCKS5)
+	if !ok || p.URL().String() != "socks5://[2001:db8::1]:8080" {
+		t.Errorf("newCandidate with bare IPv6 host = %v, %v", p, ok)
 	}
 }
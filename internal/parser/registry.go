@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aredoff/proxygun/internal/parser/providers"
+)
+
+// factory builds a provider from its parameters
+type factory func(params map[string]string) (Parser, error)
+
+// registry maps lower-case provider names to their factories
+var registry = map[string]factory{
+	"sslproxies":      noParams(func() Parser { return providers.NewSSLProxiesProvider() }),
+	"usproxy":         noParams(func() Parser { return providers.NewUSProxyProvider() }),
+	"freeproxylist":   noParams(func() Parser { return providers.NewFreeProxyListProvider() }),
+	"checkerproxynet": noParams(func() Parser { return providers.NewCheckerProxyNetProvider() }),
+	"hidemyname":      noParams(func() Parser { return providers.NewHideMyNameProvider() }),
+	"githubmmpx12":    noParams(func() Parser { return providers.NewGithubMmpx12Provider() }),
+	"githubthespeedx": func(params map[string]string) (Parser, error) {
+		p := providers.NewGithubTheSpeedXProvider()
+		for key, value := range params {
+			switch key {
+			case "urls":
+				p.SetURLs(splitList(value))
+			default:
+				return nil, unknownParam(key)
+			}
+		}
+		return p, nil
+	},
+	"kuaidaili": func(params map[string]string) (Parser, error) {
+		p := providers.NewKuaidailiProvider()
+		for key, value := range params {
+			switch key {
+			case "pages":
+				pages, err := strconv.Atoi(value)
+				if err != nil || pages <= 0 {
+					return nil, fmt.Errorf("pages must be a positive integer, got %q", value)
+				}
+				p.SetPages(pages)
+			default:
+				return nil, unknownParam(key)
+			}
+		}
+		return p, nil
+	},
+	"file": func(params map[string]string) (Parser, error) {
+		path := params["path"]
+		if path == "" {
+			return nil, fmt.Errorf("path parameter is required")
+		}
+		for key := range params {
+			if key != "path" {
+				return nil, unknownParam(key)
+			}
+		}
+		return providers.NewFileProvider(path), nil
+	},
+}
+
+// New builds the provider registered under name (case-insensitive)
+func New(name string, params map[string]string) (Parser, error) {
+	f, ok := registry[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q (known: %s)", name, strings.Join(Names(), ", "))
+	}
+
+	p, err := f(params)
+	if err != nil {
+		return nil, fmt.Errorf("provider %s: %w", name, err)
+	}
+	return p, nil
+}
+
+// Names returns the registered provider names
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func noParams(build func() Parser) factory {
+	return func(params map[string]string) (Parser, error) {
+		for key := range params {
+			return nil, unknownParam(key)
+		}
+		return build(), nil
+	}
+}
+
+func unknownParam(key string) error {
+	return fmt.Errorf("unknown parameter %q", key)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// Schedule controls how often a provider is scraped and for how long
+type Schedule struct {
+	Interval time.Duration // Minimum time between scrapes
+	Timeout  time.Duration // Time a scrape may take before it is abandoned, zero waits
+	Jitter   float64       // Random extra delay as a fraction of Interval
+}
+
+// Polite is implemented by providers whose site must not be scraped more
+// often than MinInterval, whatever their schedule says
+type Polite interface {
+	MinInterval() time.Duration
+}
+
+// Source is a provider with its scraping schedule
+type Source struct {
+	Parser
+	Schedule Schedule
+}
+
+// Result is the outcome of scraping one provider
+type Result struct {
+	Provider string
+	Proxies  []*proxy.Proxy
+	Err      error
+	Duration time.Duration
+}
+
+// NewSource wraps a provider with a schedule, raising the interval to the
+// provider's polite minimum
+func NewSource(p Parser, schedule Schedule) Source {
+	if polite, ok := p.(Polite); ok && schedule.Interval < polite.MinInterval() {
+		schedule.Interval = polite.MinInterval()
+	}
+	return Source{Parser: p, Schedule: schedule}
+}
+
+// minInterval returns the polite minimum time between scrapes, zero when the
+// provider has none
+func (s Source) minInterval() time.Duration {
+	if polite, ok := s.Parser.(Polite); ok {
+		return polite.MinInterval()
+	}
+	return 0
+}
+
+// delay returns the time until the next scrape with jitter applied
+func (s Schedule) delay() time.Duration {
+	d := s.Interval
+	if s.Jitter > 0 && d > 0 {
+		d += time.Duration(rand.Float64() * s.Jitter * float64(d))
+	}
+	return d
+}
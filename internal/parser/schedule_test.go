@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+type fakeParser struct {
+	name  string
+	delay time.Duration
+	calls atomic.Int32
+	found []*proxy.Proxy
+}
+
+func (p *fakeParser) Name() string { return p.name }
+
+func (p *fakeParser) Parse() ([]*proxy.Proxy, error) {
+	p.calls.Add(1)
+	time.Sleep(p.delay)
+	return p.found, nil
+}
+
+func TestScrapeDue(t *testing.T) {
+	fast := &fakeParser{name: "fast", found: []*proxy.Proxy{{Host: "1.1.1.1", Port: 80}}}
+	slow := &fakeParser{name: "slow", delay: 200 * time.Millisecond}
+	rp := NewRotatingParser([]Source{
+		NewSource(fast, Schedule{Interval: time.Hour}),
+		NewSource(slow, Schedule{Interval: time.Hour, Timeout: 20 * time.Millisecond}),
+	})
+
+	start := time.Now()
+	results := rp.ScrapeDue(context.Background(), false)
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("slow provider held up the scrape for %s", elapsed)
+	}
+	if len(results) != 2 || len(results[0].Proxies) != 1 || results[1].Err == nil {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	// Nothing is due before the interval passes
+	if results := rp.ScrapeDue(context.Background(), false); len(results) != 0 {
+		t.Errorf("scraped %d providers before they were due", len(results))
+	}
+
+	// Forcing skips the slow provider while its abandoned scrape still runs
+	results = rp.ScrapeDue(context.Background(), true)
+	if len(results) != 1 || results[0].Provider != "fast" {
+		t.Errorf("forced scrape results: %+v", results)
+	}
+	if slow.calls.Load() != 1 {
+		t.Errorf("slow provider started %d times", slow.calls.Load())
+	}
+}
+
+type politeParser struct{ fakeParser }
+
+func (p *politeParser) MinInterval() time.Duration { return time.Hour }
+
+func TestNewSourcePolite(t *testing.T) {
+	s := NewSource(&politeParser{fakeParser{name: "polite"}}, Schedule{Interval: time.Minute})
+	if s.Schedule.Interval != time.Hour {
+		t.Errorf("interval = %s, want the polite minimum", s.Schedule.Interval)
+	}
+}
+
+func TestScrapeDuePoliteForce(t *testing.T) {
+	polite := &politeParser{fakeParser{name: "polite", found: []*proxy.Proxy{{Host: "1.1.1.1", Port: 80}}}}
+	plain := &fakeParser{name: "plain", found: []*proxy.Proxy{{Host: "2.2.2.2", Port: 80}}}
+	rp := NewRotatingParser([]Source{
+		NewSource(polite, Schedule{Interval: time.Minute}),
+		NewSource(plain, Schedule{Interval: time.Minute}),
+	})
+
+	if results := rp.ScrapeDue(context.Background(), true); len(results) != 2 {
+		t.Fatalf("first forced scrape results: %+v", results)
+	}
+	// A second forced scrape right away leaves the polite provider alone
+	results := rp.ScrapeDue(context.Background(), true)
+	if len(results) != 1 || results[0].Provider != "plain" {
+		t.Errorf("second forced scrape results: %+v", results)
+	}
+	if polite.calls.Load() != 1 {
+		t.Errorf("polite provider scraped %d times", polite.calls.Load())
+	}
+}
+
+func TestBackoffAndYieldOrder(t *testing.T) {
+	empty := &fakeParser{name: "empty"}
+	good := &fakeParser{name: "good", found: []*proxy.Proxy{{Host: "1.1.1.1", Port: 80}}}
+	better := &fakeParser{name: "better", found: []*proxy.Proxy{{Host: "2.2.2.2", Port: 80}}}
+	rp := NewRotatingParser([]Source{
+		NewSource(empty, Schedule{Interval: time.Minute}),
+		NewSource(good, Schedule{Interval: time.Minute}),
+		NewSource(better, Schedule{Interval: time.Minute}),
+	})
+	rp.RecordValidated("good", 10, 8)
+	rp.RecordValidated("better", 10, 10)
+
+	results := rp.ScrapeDue(context.Background(), true)
+	if len(results) != 3 || results[0].Provider != "better" || results[1].Provider != "good" {
+		t.Fatalf("results not ordered by yield: %+v", results)
+	}
+
+	// The empty provider backs off even from forced scrapes
+	results = rp.ScrapeDue(context.Background(), true)
+	if len(results) != 2 {
+		t.Errorf("scraped %d providers, want the empty one backed off", len(results))
+	}
+	for _, status := range rp.Providers() {
+		if status.Name == "empty" && (status.Health.ConsecutiveFailures != 1 || status.Health.BackoffUntil.IsZero()) {
+			t.Errorf("empty provider health: %+v", status.Health)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	if d := backoff(time.Minute, 3); d != 4*time.Minute {
+		t.Errorf("backoff after 3 failures = %s", d)
+	}
+	if d := backoff(time.Minute, 20); d != maxBackoff {
+		t.Errorf("backoff is not capped: %s", d)
+	}
+}
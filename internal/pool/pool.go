@@ -1,7 +1,12 @@
 package pool
 
 import (
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/aredoff/proxygun/internal/proxy"
 )
@@ -16,46 +21,104 @@ type Pool struct {
 	freePool    []*proxy.ProxyWithStats          //Pool of free proxies
 	current     int
 	maxSize     int
+	freeMaxSize int
 	minRequests int
 	mu          sync.RWMutex
 }
 
-func NewPool(maxSize int) *Pool {
+// NewPool creates a pool with maxSize active proxies and up to freeMaxSize
+// spare proxies; freeMaxSize <= 0 leaves the free pool unbounded
+func NewPool(maxSize, freeMaxSize int) *Pool {
 	return &Pool{
 		proxies:     make([]*proxy.ProxyWithStats, 0, maxSize),
 		badProxies:  make(map[string]*proxy.ProxyWithStats),
 		freePool:    make([]*proxy.ProxyWithStats, 0),
 		maxSize:     maxSize,
+		freeMaxSize: freeMaxSize,
 		minRequests: 10,
 	}
 }
 
 func (p *Pool) Add(proxy *proxy.Proxy) bool {
+	return p.AddWithStats(NewProxyWithStats(proxy))
+}
+
+// AddWithStats adds a proxy keeping its already collected stats
+func (p *Pool) AddWithStats(proxyWithStats *proxy.ProxyWithStats) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	proxyKey := proxy.String()
+	proxyKey := proxyWithStats.Proxy.String()
 	if _, exists := p.badProxies[proxyKey]; exists {
 		return false
 	}
 
-	for _, p := range p.proxies {
-		if p.Proxy.String() == proxyKey {
-			return false
-		}
+	if p.indexOf(p.proxies, proxyKey) >= 0 || p.indexOf(p.freePool, proxyKey) >= 0 {
+		return false
 	}
 
-	proxyWithStats := NewProxyWithStats(proxy)
-
 	if len(p.proxies) < p.maxSize {
 		p.proxies = append(p.proxies, proxyWithStats)
 		return true
 	}
 
+	if p.freeMaxSize > 0 && len(p.freePool) >= p.freeMaxSize {
+		return false
+	}
+
 	p.freePool = append(p.freePool, proxyWithStats)
 	return true
 }
 
+func (p *Pool) indexOf(segment []*proxy.ProxyWithStats, proxyKey string) int {
+	for i, px := range segment {
+		if px.Proxy.String() == proxyKey {
+			return i
+		}
+	}
+	return -1
+}
+
+// Contains reports whether the proxy is already known to the main, free or bad pool
+func (p *Pool) Contains(proxy *proxy.Proxy) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	proxyKey := proxy.String()
+	if _, exists := p.badProxies[proxyKey]; exists {
+		return true
+	}
+	return p.indexOf(p.proxies, proxyKey) >= 0 || p.indexOf(p.freePool, proxyKey) >= 0
+}
+
+// Find returns the main or free pool entry of the proxy, or nil when it is not pooled
+func (p *Pool) Find(proxy *proxy.Proxy) *proxy.ProxyWithStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	proxyKey := proxy.String()
+	if i := p.indexOf(p.proxies, proxyKey); i >= 0 {
+		return p.proxies[i]
+	}
+	if i := p.indexOf(p.freePool, proxyKey); i >= 0 {
+		return p.freePool[i]
+	}
+	return nil
+}
+
+// Full reports whether the main and free pools are both at capacity. An
+// unbounded free pool counts as full once it holds as many spares as the
+// main pool, so validation still stops at some point.
+func (p *Pool) Full() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	freeCap := p.freeMaxSize
+	if freeCap <= 0 {
+		freeCap = p.maxSize
+	}
+	return len(p.proxies) >= p.maxSize && len(p.freePool) >= freeCap
+}
+
 func (p *Pool) fillProxiesFromFree() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -75,48 +138,106 @@ func (p *Pool) fillProxiesFromFree() {
 	}
 }
 
+// Resize changes the pool capacities. Proxies beyond the new maxSize are
+// demoted to the front of the free pool, which is then trimmed to
+// freeMaxSize. It returns the number of demoted proxies.
+func (p *Pool) Resize(maxSize, freeMaxSize int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.maxSize = maxSize
+	p.freeMaxSize = freeMaxSize
+
+	demoted := 0
+	if len(p.proxies) > maxSize {
+		excess := p.proxies[maxSize:]
+		demoted = len(excess)
+		p.freePool = append(append(make([]*proxy.ProxyWithStats, 0, len(excess)+len(p.freePool)), excess...), p.freePool...)
+		p.proxies = p.proxies[:maxSize:maxSize]
+		if p.current >= len(p.proxies) {
+			p.current = 0
+		}
+	}
+
+	if freeMaxSize > 0 && len(p.freePool) > freeMaxSize {
+		p.freePool = p.freePool[:freeMaxSize]
+	}
+	return demoted
+}
+
 // FillFromFree moves proxies from free pool to main pool if needed
 func (p *Pool) FillFromFree() {
 	p.fillProxiesFromFree()
 }
 
 func (p *Pool) Next() *proxy.ProxyWithStats {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	p.fillProxiesFromFree()
+
+	// Advancing the rotation writes p.current, so a read lock is not enough
+	p.mu.Lock()
+	defer p.mu.Unlock()
 
 	if len(p.proxies) == 0 {
 		return nil
 	}
 
-	if len(p.proxies) < p.maxSize {
-		p.mu.RUnlock()
-		p.fillProxiesFromFree()
-		p.mu.RLock()
+	// Compare the proxy in rotation with a random one and prefer the faster
+	proxy := p.proxies[p.current]
+	p.current = (p.current + 1) % len(p.proxies)
 
-		if len(p.proxies) == 0 {
-			return nil
+	other := p.proxies[rand.Intn(len(p.proxies))]
+	if faster(other, proxy) {
+		return other
+	}
+	return proxy
+}
+
+// faster reports whether a has a measured latency lower than b
+func faster(a, b *proxy.ProxyWithStats) bool {
+	la, lb := a.Latency(), b.Latency()
+	return la > 0 && (lb == 0 || la < lb)
+}
+
+// NextMatching returns the next proxy in rotation accepted by match, or nil
+func (p *Pool) NextMatching(match func(*proxy.ProxyWithStats) bool) *proxy.ProxyWithStats {
+	p.fillProxiesFromFree()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := 0; i < len(p.proxies); i++ {
+		idx := (p.current + i) % len(p.proxies)
+		if match(p.proxies[idx]) {
+			p.current = (idx + 1) % len(p.proxies)
+			return p.proxies[idx]
 		}
 	}
+	return nil
+}
 
-	proxy := p.proxies[p.current]
-	p.current = (p.current + 1) % len(p.proxies)
-	return proxy
+// Proxies returns the proxies of the main and free pools
+func (p *Pool) Proxies() []*proxy.ProxyWithStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return append(slices.Clone(p.proxies), p.freePool...)
 }
 
+// Remove forgets a proxy of the main or free pool without banning it, so it
+// can be added again when a provider lists it
 func (p *Pool) Remove(proxy *proxy.Proxy) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	proxyKey := proxy.String()
 
-	for i, px := range p.proxies {
-		if px.Proxy.String() == proxyKey {
-			p.proxies = append(p.proxies[:i], p.proxies[i+1:]...)
-			if p.current >= len(p.proxies) && len(p.proxies) > 0 {
-				p.current = 0
-			}
-			break
+	if i := p.indexOf(p.proxies, proxyKey); i >= 0 {
+		p.proxies = append(p.proxies[:i], p.proxies[i+1:]...)
+		if p.current >= len(p.proxies) && len(p.proxies) > 0 {
+			p.current = 0
 		}
+	} else if i := p.indexOf(p.freePool, proxyKey); i >= 0 {
+		p.freePool = append(p.freePool[:i], p.freePool[i+1:]...)
 	}
 
 	if len(p.freePool) > 0 && len(p.proxies) < p.maxSize {
@@ -142,19 +263,71 @@ func (p *Pool) MoveToBad(proxy *proxy.Proxy) {
 		}
 	}
 
+	for i, px := range p.freePool {
+		if px.Proxy.String() == proxyKey {
+			p.badProxies[proxyKey] = px
+			p.freePool = append(p.freePool[:i], p.freePool[i+1:]...)
+			break
+		}
+	}
+
 	if len(p.freePool) > 0 && len(p.proxies) < p.maxSize {
 		p.proxies = append(p.proxies, p.freePool[0])
 		p.freePool = p.freePool[1:]
 	}
 }
 
+// Idle returns up to limit proxies from the main and free pools that were not
+// used or validated within the idle duration, least recently active first
+func (p *Pool) Idle(idle time.Duration, limit int) []*proxy.ProxyWithStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	threshold := time.Now().Add(-idle)
+	var candidates []*proxy.ProxyWithStats
+	for _, segment := range [][]*proxy.ProxyWithStats{p.proxies, p.freePool} {
+		for _, px := range segment {
+			if px.LastActive().Before(threshold) {
+				candidates = append(candidates, px)
+			}
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].LastActive().Before(candidates[j].LastActive())
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
+
+// DropStaleFree forgets free pool proxies not verified within maxAge and
+// returns how many were dropped
+func (p *Pool) DropStaleFree(maxAge time.Duration) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	threshold := time.Now().Add(-maxAge)
+	kept := p.freePool[:0]
+	for _, px := range p.freePool {
+		if px.LastVerified().After(threshold) {
+			kept = append(kept, px)
+		}
+	}
+	dropped := len(p.freePool) - len(kept)
+	clear(p.freePool[len(kept):])
+	p.freePool = kept
+	return dropped
+}
+
 func (p *Pool) CheckBadProxies() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
 	for i := len(p.proxies) - 1; i >= 0; i-- {
 		proxy := p.proxies[i]
-		if proxy.Stats.IsBad(p.minRequests) {
+		if proxy.IsBad(p.minRequests) {
 			proxyKey := proxy.Proxy.String()
 			p.badProxies[proxyKey] = proxy
 			p.proxies = append(p.proxies[:i], p.proxies[i+1:]...)
@@ -171,18 +344,98 @@ func (p *Pool) CheckBadProxies() {
 	}
 }
 
+// Sample returns a random subset of the main pool covering the given fraction of it
+func (p *Pool) Sample(fraction float64) []*proxy.ProxyWithStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if fraction <= 0 || len(p.proxies) == 0 {
+		return nil
+	}
+
+	n := int(math.Ceil(float64(len(p.proxies)) * math.Min(fraction, 1)))
+	sample := make([]*proxy.ProxyWithStats, 0, n)
+	for _, i := range rand.Perm(len(p.proxies))[:n] {
+		sample = append(sample, p.proxies[i])
+	}
+	return sample
+}
+
 func (p *Pool) Size() int {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	return len(p.proxies)
 }
 
+// CountBySource returns how many main and free pool proxies came from each source
+func (p *Pool) CountBySource() map[string]int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, px := range p.proxies {
+		counts[px.Proxy.Source]++
+	}
+	for _, px := range p.freePool {
+		counts[px.Proxy.Source]++
+	}
+	return counts
+}
+
 func (p *Pool) FreeSize() int {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	return len(p.freePool)
 }
 
+func (p *Pool) BadSize() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.badProxies)
+}
+
+// Ban moves a proxy to the bad pool whether or not it is currently pooled
+func (p *Pool) Ban(px *proxy.Proxy) {
+	p.MoveToBad(px)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	proxyKey := px.String()
+	if _, exists := p.badProxies[proxyKey]; !exists {
+		p.badProxies[proxyKey] = NewProxyWithStats(px)
+	}
+}
+
+// Unban forgets a bad proxy and returns it to the pool with fresh stats.
+// It reports whether the proxy was banned.
+func (p *Pool) Unban(px *proxy.Proxy) bool {
+	p.mu.Lock()
+	proxyKey := px.String()
+	banned, exists := p.badProxies[proxyKey]
+	delete(p.badProxies, proxyKey)
+	p.mu.Unlock()
+
+	if !exists {
+		return false
+	}
+	p.Add(banned.Proxy)
+	return true
+}
+
+// Drain empties the main and free pools, keeping bad proxy knowledge,
+// and returns how many proxies were removed
+func (p *Pool) Drain() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	drained := len(p.proxies) + len(p.freePool)
+	p.proxies = make([]*proxy.ProxyWithStats, 0, p.maxSize)
+	p.freePool = make([]*proxy.ProxyWithStats, 0)
+	p.current = 0
+	return drained
+}
+
 func (p *Pool) NeedsProxies() int {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
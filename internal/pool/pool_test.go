@@ -0,0 +1,90 @@
+package pool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestIdle(t *testing.T) {
+	p := NewPool(1, 10)
+	old := proxy.NewProxyWithStats(&proxy.Proxy{Host: "10.0.0.1", Port: 80})
+	old.Stats.FirstUsed = time.Now().Add(-time.Hour)
+	older := proxy.NewProxyWithStats(&proxy.Proxy{Host: "10.0.0.2", Port: 80})
+	older.Stats.FirstUsed = time.Now().Add(-2 * time.Hour)
+	fresh := proxy.NewProxyWithStats(&proxy.Proxy{Host: "10.0.0.3", Port: 80})
+	p.AddWithStats(old)   // Main pool
+	p.AddWithStats(older) // Free pool
+	p.AddWithStats(fresh)
+
+	idle := p.Idle(30*time.Minute, 0)
+	if len(idle) != 2 || idle[0] != older || idle[1] != old {
+		t.Fatalf("Idle returned %v, want the free then the main pool proxy, least recently active first", idle)
+	}
+	if idle := p.Idle(30*time.Minute, 1); len(idle) != 1 || idle[0] != older {
+		t.Errorf("Idle with limit 1 returned %v", idle)
+	}
+
+	old.RecordCheck()
+	if idle := p.Idle(30*time.Minute, 0); len(idle) != 1 {
+		t.Errorf("a just checked proxy is still idle: %v", idle)
+	}
+}
+
+func TestDropStaleFree(t *testing.T) {
+	p := NewPool(1, 10)
+	p.Add(&proxy.Proxy{Host: "10.0.0.1", Port: 80})
+	stale := proxy.NewProxyWithStats(&proxy.Proxy{Host: "10.0.0.2", Port: 80})
+	stale.Stats.FirstUsed = time.Now().Add(-time.Hour)
+	p.AddWithStats(stale)
+	p.Add(&proxy.Proxy{Host: "10.0.0.3", Port: 80})
+
+	if dropped := p.DropStaleFree(30 * time.Minute); dropped != 1 {
+		t.Fatalf("dropped %d proxies, want 1", dropped)
+	}
+	if p.Contains(stale.Proxy) || p.FreeSize() != 1 || p.Size() != 1 {
+		t.Errorf("stale proxy kept or others lost: main %d, free %d", p.Size(), p.FreeSize())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	p := NewPool(1, 10)
+	main := &proxy.Proxy{Host: "10.0.0.1", Port: 80}
+	free := &proxy.Proxy{Host: "10.0.0.2", Port: 80}
+	spare := &proxy.Proxy{Host: "10.0.0.3", Port: 80}
+	p.Add(main)
+	p.Add(free)
+	p.Add(spare)
+
+	p.Remove(spare)
+	if p.Contains(spare) || p.FreeSize() != 1 {
+		t.Fatalf("free pool proxy not removed: free %d", p.FreeSize())
+	}
+	p.Remove(main)
+	if p.Contains(main) || !p.Contains(free) || p.Size() != 1 || p.FreeSize() != 0 {
+		t.Fatalf("after removing the main proxy: main %d, free %d", p.Size(), p.FreeSize())
+	}
+	p.Remove(free)
+	if p.Size() != 0 || p.BadSize() != 0 {
+		t.Fatalf("after removing the promoted proxy: main %d, bad %d", p.Size(), p.BadSize())
+	}
+	if !p.Add(main) {
+		t.Error("a removed proxy cannot be added again")
+	}
+}
+
+func TestFullUnboundedFree(t *testing.T) {
+	p := NewPool(1, 0)
+	p.Add(&proxy.Proxy{Host: "10.0.0.1", Port: 80})
+	if p.Full() {
+		t.Fatal("full with an empty unbounded free pool")
+	}
+	p.Add(&proxy.Proxy{Host: "10.0.0.2", Port: 80})
+	if !p.Full() {
+		t.Fatal("not full with as many spares as the main pool")
+	}
+	if !p.Add(&proxy.Proxy{Host: "10.0.0.3", Port: 80}) {
+		t.Error("an unbounded free pool rejected a spare")
+	}
+}
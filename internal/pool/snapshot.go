@@ -0,0 +1,113 @@
+package pool
+
+import (
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// Pool segments as stored in snapshots
+const (
+	SegmentMain = "main"
+	SegmentFree = "free"
+	SegmentBad  = "bad"
+)
+
+// Entry is a proxy with its metadata, stats and the pool segment it belongs to
+type Entry struct {
+	Proxy   string      `json:"proxy"`
+	Segment string      `json:"segment"`
+	Stats   proxy.Stats `json:"stats"`
+	proxy.Metadata
+}
+
+// Snapshot is a point-in-time copy of the whole pool
+type Snapshot struct {
+	SavedAt time.Time `json:"saved_at"`
+	Entries []Entry   `json:"entries"`
+}
+
+// Snapshot copies the main, free and bad pools with their stats
+func (p *Pool) Snapshot() *Snapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	snapshot := &Snapshot{
+		SavedAt: time.Now(),
+		Entries: make([]Entry, 0, len(p.proxies)+len(p.freePool)+len(p.badProxies)),
+	}
+
+	add := func(segment string, px *proxy.ProxyWithStats) {
+		snapshot.Entries = append(snapshot.Entries, Entry{
+			Proxy:    px.Proxy.URL().String(),
+			Segment:  segment,
+			Stats:    px.StatsSnapshot(),
+			Metadata: px.Proxy.Metadata,
+		})
+	}
+
+	for _, px := range p.proxies {
+		add(SegmentMain, px)
+	}
+	for _, px := range p.freePool {
+		add(SegmentFree, px)
+	}
+	for _, px := range p.badProxies {
+		add(SegmentBad, px)
+	}
+	return snapshot
+}
+
+// Restore loads snapshot entries into the pool, skipping proxies it already
+// knows, and returns how many were restored. Main pool entries beyond the
+// pool size are kept in the free pool. Main and free entries are only restored
+// when admit, if not nil, accepts them; bans are always kept.
+func (p *Pool) Restore(snapshot *Snapshot, admit func(*proxy.Proxy) bool) int {
+	// Admission may look up DNS names, so it runs before taking the lock
+	proxies := make([]*proxy.Proxy, len(snapshot.Entries))
+	for i, entry := range snapshot.Entries {
+		px, err := proxy.Parse(entry.Proxy)
+		if err != nil {
+			continue
+		}
+		px.Metadata = entry.Metadata
+		if entry.Segment == SegmentBad || admit == nil || admit(px) {
+			proxies[i] = px
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	restored := 0
+	for i, entry := range snapshot.Entries {
+		px := proxies[i]
+		if px == nil {
+			continue
+		}
+
+		proxyKey := px.String()
+		if _, exists := p.badProxies[proxyKey]; exists {
+			continue
+		}
+		if p.indexOf(p.proxies, proxyKey) >= 0 || p.indexOf(p.freePool, proxyKey) >= 0 {
+			continue
+		}
+
+		stats := entry.Stats
+		proxyWithStats := &proxy.ProxyWithStats{Proxy: px, Stats: &stats}
+
+		switch {
+		case entry.Segment == SegmentBad:
+			p.badProxies[proxyKey] = proxyWithStats
+		case entry.Segment == SegmentMain && len(p.proxies) < p.maxSize:
+			p.proxies = append(p.proxies, proxyWithStats)
+		case p.freeMaxSize <= 0 || len(p.freePool) < p.freeMaxSize:
+			p.freePool = append(p.freePool, proxyWithStats)
+		default:
+			continue
+		}
+		restored++
+	}
+	return restored
+}
@@ -0,0 +1,68 @@
+package pool
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	p := NewPool(1, 10)
+	main, _ := proxy.Parse("socks5h://[2001:db8::1]:1080")
+	main.Country = "DE"
+	main.Source = "test"
+	free, _ := proxy.Parse("https://proxy.example.com:443")
+	bad, _ := proxy.Parse("10.0.0.3:80")
+	p.Add(main)
+	p.Add(free)
+	p.Add(bad)
+	p.MoveToBad(bad)
+	p.Find(main).RecordLatency(50 * time.Millisecond)
+	p.Find(main).RecordSuccess()
+
+	// Through JSON, as the state file stores it
+	data, err := json.Marshal(p.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewPool(1, 10)
+	if n := restored.Restore(&snapshot, nil); n != 3 {
+		t.Fatalf("restored %d proxies, want 3", n)
+	}
+	if restored.Size() != 1 || restored.FreeSize() != 1 || restored.BadSize() != 1 {
+		t.Fatalf("segments main %d, free %d, bad %d, want 1 each", restored.Size(), restored.FreeSize(), restored.BadSize())
+	}
+	got := restored.Find(main)
+	if got == nil || *got.Proxy != *main {
+		t.Fatalf("main proxy restored as %+v, want %+v", got, main)
+	}
+	if stats := got.StatsSnapshot(); stats.SuccessRequests != 1 || stats.Latency != 50*time.Millisecond {
+		t.Errorf("stats restored as %+v", stats)
+	}
+	if got := restored.Find(free); got == nil || got.Proxy.Type != proxy.HTTPS {
+		t.Errorf("free proxy restored as %+v", got)
+	}
+	if restored.Add(bad) {
+		t.Error("a restored bad proxy was added again")
+	}
+
+	if n := restored.Restore(&snapshot, nil); n != 0 {
+		t.Errorf("restoring twice added %d proxies", n)
+	}
+
+	// Rejected proxies are left out, bans are kept
+	filtered := NewPool(1, 10)
+	if n := filtered.Restore(&snapshot, func(px *proxy.Proxy) bool { return px.Country == "DE" }); n != 2 {
+		t.Fatalf("restored %d proxies through the filter, want 2", n)
+	}
+	if !filtered.Contains(main) || filtered.Contains(free) || filtered.BadSize() != 1 {
+		t.Errorf("filtered restore: main %t, free %t, bad %d", filtered.Contains(main), filtered.Contains(free), filtered.BadSize())
+	}
+}
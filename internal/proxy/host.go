@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// NormalizeHost validates a proxy host, an IPv4 or IPv6 address or a DNS
+// name, and returns the canonical form used in proxy keys: IPv6 compressed
+// and unbracketed, IPv4-mapped addresses unmapped, names lowercased. IPv4
+// octets with leading zeros, as some lists print them, are accepted.
+func NormalizeHost(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if host == "" {
+		return "", fmt.Errorf("empty proxy host")
+	}
+
+	if addr, ok := parseIPv4(host); ok {
+		return addr.String(), nil
+	}
+	if strings.Contains(host, ":") {
+		addr, err := netip.ParseAddr(host)
+		if err != nil || addr.Zone() != "" {
+			return "", fmt.Errorf("invalid proxy address %q", host)
+		}
+		return addr.Unmap().String(), nil
+	}
+	if !isDNSName(host) {
+		return "", fmt.Errorf("invalid proxy host %q", host)
+	}
+	return strings.ToLower(strings.TrimSuffix(host, ".")), nil
+}
+
+// ParseHostPort reads a proxy address such as 1.2.3.4:8080,
+// [2001:db8::1]:8080 or proxy.example.com:3128 into a normalized host and port
+func ParseHostPort(s string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(strings.TrimSpace(s))
+	if err != nil {
+		return "", 0, err
+	}
+	return normalizeHostPort(host, portStr)
+}
+
+// normalizeHostPort validates a host and a port given separately
+func normalizeHostPort(host, portStr string) (string, int, error) {
+	host, err := NormalizeHost(host)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(portStr))
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid proxy port %q", portStr)
+	}
+	return host, port, nil
+}
+
+// parseIPv4 reads a dotted-quad address, tolerating leading zeros in octets
+func parseIPv4(s string) (netip.Addr, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return netip.Addr{}, false
+	}
+	var octets [4]byte
+	for i, part := range parts {
+		if len(part) == 0 || len(part) > 3 {
+			return netip.Addr{}, false
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || n > 255 || part[0] == '+' || part[0] == '-' {
+			return netip.Addr{}, false
+		}
+		octets[i] = byte(n)
+	}
+	return netip.AddrFrom4(octets), true
+}
+
+// isDNSName reports whether s is a syntactically valid hostname. The last
+// label must not be all digits so malformed addresses are not taken for names.
+func isDNSName(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	if len(s) == 0 || len(s) > 253 {
+		return false
+	}
+	labels := strings.Split(s, ".")
+	for _, label := range labels {
+		if len(label) == 0 || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	last := labels[len(labels)-1]
+	return strings.Trim(last, "0123456789") != ""
+}
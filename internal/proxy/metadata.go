@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"strings"
+	"time"
+)
+
+// Anonymity is the anonymity level a provider claims for a proxy
+type Anonymity int
+
+const (
+	AnonymityUnknown Anonymity = iota
+	Transparent
+	Anonymous
+	Elite
+)
+
+func (a Anonymity) String() string {
+	switch a {
+	case Transparent:
+		return "transparent"
+	case Anonymous:
+		return "anonymous"
+	case Elite:
+		return "elite"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseAnonymity reads the anonymity labels used by proxy list sites,
+// returning AnonymityUnknown for anything it does not recognise
+func ParseAnonymity(s string) Anonymity {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case s == "":
+		return AnonymityUnknown
+	case strings.Contains(s, "elite"), strings.Contains(s, "high"), strings.Contains(s, "高匿"):
+		return Elite
+	case strings.Contains(s, "transparent"), s == "no", strings.Contains(s, "透明"):
+		return Transparent
+	case strings.Contains(s, "anonym"), strings.Contains(s, "average"), strings.Contains(s, "low"), strings.Contains(s, "匿名"):
+		return Anonymous
+	default:
+		return AnonymityUnknown
+	}
+}
+
+func (a Anonymity) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Anonymity) UnmarshalText(text []byte) error {
+	*a = ParseAnonymity(string(text))
+	return nil
+}
+
+// Metadata is what is known about a proxy besides its address. Country,
+// anonymity and HTTPS are claimed by the list site unless a GeoIP database
+// replaced the country.
+type Metadata struct {
+	Source       string    `json:"source,omitempty"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+	Country      string    `json:"country,omitempty"` // ISO 3166-1 alpha-2 code
+	Anonymity    Anonymity `json:"anonymity,omitempty"`
+	HTTPS        bool      `json:"https,omitempty"`
+
+	// Set by the validator when the proxy resolves destination hostnames itself
+	RemoteDNS bool `json:"remote_dns,omitempty"`
+
+	// Filled from local GeoIP/ASN databases
+	City    string `json:"city,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+	Network string `json:"network,omitempty"` // "datacenter" or "residential" where known
+}
+
+// NormalizeCountry returns an upper-case two-letter country code, or an
+// empty string when code is not one
+func NormalizeCountry(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return ""
+	}
+	return code
+}
@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,38 +16,102 @@ const (
 	HTTP Type = iota
 	SOCKS4
 	SOCKS5
+	HTTPS // HTTP proxy reached over TLS
 )
 
+func (t Type) String() string {
+	switch t {
+	case HTTP:
+		return "http"
+	case SOCKS4:
+		return "socks4"
+	case SOCKS5:
+		return "socks5"
+	case HTTPS:
+		return "https"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseType reads a proxy type from its scheme name
+func ParseType(s string) (Type, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "http":
+		return HTTP, nil
+	case "socks4":
+		return SOCKS4, nil
+	case "socks5":
+		return SOCKS5, nil
+	case "https":
+		return HTTPS, nil
+	default:
+		return HTTP, fmt.Errorf("unsupported proxy type %q", s)
+	}
+}
+
 type Proxy struct {
-	Host string
-	Port int
-	Type Type
+	Host    string
+	Port    int
+	Type    Type
+	Resolve Resolution
+	Metadata
 }
 
+// String returns the proxy address, with IPv6 hosts in brackets. It is the
+// key proxies are deduplicated by.
 func (p *Proxy) String() string {
-	return fmt.Sprintf("%s:%d", p.Host, p.Port)
+	return net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
 }
 
 func (p *Proxy) URL() *url.URL {
-	var scheme string
-	switch p.Type {
-	case HTTP:
-		scheme = "http"
-	case SOCKS4:
-		scheme = "socks4"
-	case SOCKS5:
-		scheme = "socks5"
+	return &url.URL{
+		Scheme: p.Scheme(),
+		Host:   p.String(),
+	}
+}
+
+// Parse reads a proxy from a scheme URL such as socks5://1.2.3.4:1080 or
+// from a bare host:port, which is treated as an HTTP proxy. IPv6 hosts are
+// written in brackets and DNS names are accepted. The socks5h and socks4a
+// schemes ask for remote hostname resolution, and https:// proxies are
+// reached over TLS.
+func Parse(s string) (*Proxy, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
 	}
 
-	return &url.URL{
-		Scheme: scheme,
-		Host:   net.JoinHostPort(p.Host, fmt.Sprintf("%d", p.Port)),
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyType, resolve, err := parseScheme(u.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing proxy host in %q", s)
+	}
+	host, port, err := normalizeHostPort(u.Hostname(), u.Port())
+	if err != nil {
+		return nil, fmt.Errorf("%w in %q", err, s)
 	}
+
+	return &Proxy{
+		Host:    host,
+		Port:    port,
+		Type:    proxyType,
+		Resolve: resolve,
+	}, nil
 }
 
 type ProxyWithStats struct {
 	Proxy *Proxy
 	Stats *Stats
+	mu    sync.Mutex
 }
 
 func NewProxyWithStats(proxy *Proxy) *ProxyWithStats {
@@ -57,13 +124,85 @@ func NewProxyWithStats(proxy *Proxy) *ProxyWithStats {
 }
 
 func (p *ProxyWithStats) RecordSuccess() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.Stats.TotalRequests++
 	p.Stats.SuccessRequests++
 	p.Stats.LastUsed = time.Now()
 }
 
 func (p *ProxyWithStats) RecordFailure() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	p.Stats.TotalRequests++
 	p.Stats.FailedRequests++
 	p.Stats.LastUsed = time.Now()
 }
+
+// RecordLatency adds a time-to-first-byte observation to the smoothed latency
+func (p *ProxyWithStats) RecordLatency(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Stats.observeLatency(d)
+}
+
+// RecordThroughput adds a download speed observation to the smoothed throughput
+func (p *ProxyWithStats) RecordThroughput(bps float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Stats.observeThroughput(bps)
+}
+
+// Latency returns the smoothed latency, zero if nothing was measured yet
+func (p *ProxyWithStats) Latency() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Stats.Latency
+}
+
+// IsBad reports whether the proxy failed too often, see Stats.IsBad
+func (p *ProxyWithStats) IsBad(minRequests int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Stats.IsBad(minRequests)
+}
+
+// RecordCheck marks the proxy as just validated in the background
+func (p *ProxyWithStats) RecordCheck() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.Stats.LastChecked = time.Now()
+}
+
+// LastActive returns the latest time the proxy was added, used or validated
+func (p *ProxyWithStats) LastActive() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	last := p.Stats.FirstUsed
+	if p.Stats.LastUsed.After(last) {
+		last = p.Stats.LastUsed
+	}
+	if p.Stats.LastChecked.After(last) {
+		last = p.Stats.LastChecked
+	}
+	return last
+}
+
+// LastVerified returns the latest time the proxy was known to work
+func (p *ProxyWithStats) LastVerified() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.Stats.LastChecked.After(p.Stats.FirstUsed) {
+		return p.Stats.LastChecked
+	}
+	return p.Stats.FirstUsed
+}
+
+// StatsSnapshot returns a copy of the stats that is safe to read
+func (p *ProxyWithStats) StatsSnapshot() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return *p.Stats
+}
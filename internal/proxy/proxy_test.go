@@ -0,0 +1,39 @@
+package proxy
+
+import "testing"
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // URL the proxy is written back as
+	}{
+		{"1.2.3.4:8080", "http://1.2.3.4:8080"},
+		{"001.002.003.004:8080", "http://1.2.3.4:8080"},
+		{"socks5://1.2.3.4:1080", "socks5://1.2.3.4:1080"},
+		{"socks5h://1.2.3.4:1080", "socks5h://1.2.3.4:1080"},
+		{"socks4a://1.2.3.4:1080", "socks4a://1.2.3.4:1080"},
+		{"https://Proxy.Example.com:443", "https://proxy.example.com:443"},
+		{"http://[2001:DB8::1]:3128", "http://[2001:db8::1]:3128"},
+		{"[::ffff:1.2.3.4]:80", "http://1.2.3.4:80"},
+	}
+	for _, test := range tests {
+		p, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.in, err)
+			continue
+		}
+		if got := p.URL().String(); got != test.want {
+			t.Errorf("Parse(%q) written as %s, want %s", test.in, got, test.want)
+		}
+		again, err := Parse(p.URL().String())
+		if err != nil || *again != *p {
+			t.Errorf("%s parsed back as %+v, %v, want %+v", p.URL(), again, err, p)
+		}
+	}
+
+	for _, in := range []string{"", "ftp://1.2.3.4:21", "1.2.3.4", "1.2.3.4:0", "1.2.3.4:65536", "[fe80::1%eth0]:80", "bad host:80"} {
+		if p, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) accepted %+v", in, p)
+		}
+	}
+}
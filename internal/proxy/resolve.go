@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resolution is where destination hostnames are resolved when tunnelling
+// through a SOCKS proxy. HTTP and HTTPS proxies always resolve hostnames themselves.
+type Resolution int
+
+const (
+	ResolveDefault Resolution = iota // SOCKS5 and proxies known to speak SOCKS4a resolve remotely, other SOCKS4 proxies locally
+	ResolveLocal                     // Resolve locally and send the address
+	ResolveRemote                    // Send the hostname to the proxy (socks5h, socks4a)
+)
+
+func (r Resolution) String() string {
+	switch r {
+	case ResolveLocal:
+		return "local"
+	case ResolveRemote:
+		return "remote"
+	default:
+		return "default"
+	}
+}
+
+func (r Resolution) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Resolution) UnmarshalText(text []byte) error {
+	switch strings.ToLower(strings.TrimSpace(string(text))) {
+	case "", "default":
+		*r = ResolveDefault
+	case "local":
+		*r = ResolveLocal
+	case "remote":
+		*r = ResolveRemote
+	default:
+		return fmt.Errorf("unknown DNS resolution %q, use local or remote", text)
+	}
+	return nil
+}
+
+// RemoteResolution reports whether destination hostnames are sent to the
+// proxy instead of being resolved locally
+func (p *Proxy) RemoteResolution() bool {
+	switch {
+	case p.Type == HTTP || p.Type == HTTPS:
+		return true
+	case p.Resolve == ResolveLocal:
+		return false
+	case p.Resolve == ResolveRemote:
+		return true
+	}
+	return p.Type == SOCKS5 || p.RemoteDNS
+}
+
+// WithResolution returns p, or a copy using r when p has no resolution of its own
+func (p *Proxy) WithResolution(r Resolution) *Proxy {
+	if p.Resolve != ResolveDefault || r == ResolveDefault {
+		return p
+	}
+	c := *p
+	c.Resolve = r
+	return &c
+}
+
+// Scheme returns the URL scheme of the proxy, socks5h and socks4a for SOCKS
+// proxies set to resolve remotely
+func (p *Proxy) Scheme() string {
+	if p.Resolve == ResolveRemote {
+		switch p.Type {
+		case SOCKS4:
+			return "socks4a"
+		case SOCKS5:
+			return "socks5h"
+		}
+	}
+	return p.Type.String()
+}
+
+// parseScheme reads the type and resolution of a proxy URL scheme
+func parseScheme(scheme string) (Type, Resolution, error) {
+	switch strings.ToLower(scheme) {
+	case "socks4a":
+		return SOCKS4, ResolveRemote, nil
+	case "socks5h":
+		return SOCKS5, ResolveRemote, nil
+	}
+	proxyType, err := ParseType(scheme)
+	return proxyType, ResolveDefault, err
+}
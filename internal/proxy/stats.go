@@ -3,11 +3,39 @@ package proxy
 import "time"
 
 type Stats struct {
-	TotalRequests   int
-	SuccessRequests int
-	FailedRequests  int
-	LastUsed        time.Time
-	FirstUsed       time.Time
+	TotalRequests   int           `json:"total_requests"`
+	SuccessRequests int           `json:"success_requests"`
+	FailedRequests  int           `json:"failed_requests"`
+	LastUsed        time.Time     `json:"last_used"`
+	FirstUsed       time.Time     `json:"first_used"`
+	LastChecked     time.Time     `json:"last_checked"` // Last successful background validation
+	Latency         time.Duration `json:"latency"`      // Smoothed time to first response byte
+	Throughput      float64       `json:"throughput"`   // Smoothed download speed in bytes per second
+}
+
+// latencyWeight is the weight of a new observation in the smoothed averages
+const latencyWeight = 0.3
+
+func (s *Stats) observeLatency(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	if s.Latency == 0 {
+		s.Latency = d
+		return
+	}
+	s.Latency = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(s.Latency))
+}
+
+func (s *Stats) observeThroughput(bps float64) {
+	if bps <= 0 {
+		return
+	}
+	if s.Throughput == 0 {
+		s.Throughput = bps
+		return
+	}
+	s.Throughput = latencyWeight*bps + (1-latencyWeight)*s.Throughput
 }
 
 func (s *Stats) SuccessRate() float64 {
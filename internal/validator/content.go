@@ -0,0 +1,83 @@
+package validator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// maxContentSize limits how much of the check payload is read through a proxy
+const maxContentSize = 10 << 20
+
+// SetContentCheck enables tampering detection: the payload at url is fetched
+// through the proxy and its SHA-256 must match sha256Hex. An empty url disables the check.
+func (v *Validator) SetContentCheck(url, sha256Hex string) {
+	v.contentURL = url
+	v.contentSHA256 = strings.ToLower(strings.TrimSpace(sha256Hex))
+}
+
+// ContentCheckEnabled reports whether tampering detection is configured
+func (v *Validator) ContentCheckEnabled() bool {
+	return v.contentURL != "" && v.contentSHA256 != ""
+}
+
+// ErrContentMismatch is returned when a proxy delivers a modified check payload
+var ErrContentMismatch = errors.New("content check payload was modified by proxy")
+
+// CheckContent fetches the known payload through the proxy and verifies that
+// the body arrived unmodified. It returns nil when the check is disabled.
+func (v *Validator) CheckContent(ctx context.Context, p *proxy.Proxy) error {
+	if !v.ContentCheckEnabled() {
+		return nil
+	}
+
+	transport, err := v.transportFor(p)
+	if err != nil {
+		return err
+	}
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   v.timeout,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", v.contentURL, nil)
+	if err != nil {
+		return err
+	}
+	// Ask for an identity encoding so proxies cannot hide rewrites behind compression
+	req.Header.Set("Accept-Encoding", "identity")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Errors, auth prompts and rate limits may be transient and are not tampering
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("content check status code: %d", resp.StatusCode)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, io.LimitReader(resp.Body, maxContentSize)); err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != v.contentSHA256 {
+		return ErrContentMismatch
+	}
+	return nil
+}
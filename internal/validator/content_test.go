@@ -0,0 +1,56 @@
+package validator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestCheckContent(t *testing.T) {
+	// An HTTP proxy answering every request according to the requested path
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/match":
+			w.Write([]byte("payload"))
+		case "/mismatch":
+			w.Write([]byte("payload<script>injected</script>"))
+		default:
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	p, err := proxy.Parse(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("payload"))
+
+	tests := []struct {
+		path     string
+		wantErr  bool
+		mismatch bool
+	}{
+		{"/match", false, false},
+		{"/mismatch", true, true},
+		{"/unavailable", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			v := NewValidatorWithOptions(2*time.Second, time.Second, true)
+			v.SetContentCheck("http://check.example"+test.path, hex.EncodeToString(sum[:]))
+
+			err := v.CheckContent(context.Background(), p)
+			if (err != nil) != test.wantErr || errors.Is(err, ErrContentMismatch) != test.mismatch {
+				t.Errorf("CheckContent = %v, want error %t, mismatch %t", err, test.wantErr, test.mismatch)
+			}
+		})
+	}
+}
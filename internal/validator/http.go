@@ -5,42 +5,34 @@ import (
 	"net"
 	"net/http"
 
+	"github.com/aredoff/proxygun/internal/dialer"
 	"github.com/aredoff/proxygun/internal/proxy"
 )
 
-func (v *Validator) testHTTPProxy(p *proxy.Proxy) bool {
-	proxyURL := p.URL()
-
-	transport := &http.Transport{
-		Proxy: http.ProxyURL(proxyURL),
+func (v *Validator) httpTransport(p *proxy.Proxy) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyURL(p.URL()),
 		DialContext: (&net.Dialer{
 			Timeout: v.timeout,
 		}).DialContext,
 		TLSHandshakeTimeout: v.timeout,
+		DisableKeepAlives:   true,
 	}
+}
 
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   v.timeout,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", v.testURL, nil)
-	if err != nil {
-		return false
-	}
-
-	for k, v := range v.testHeaders {
-		req.Header.Set(k, v)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return false
+// httpsTransport speaks plain HTTP to the proxy over a TLS connection dialed
+// with the proxy TLS config, so target TLS stays with the transport
+func (v *Validator) httpsTransport(p *proxy.Proxy) *http.Transport {
+	d := dialer.New(v.timeout)
+	d.TLS = v.proxyTLS
+	proxyURL := p.URL()
+	proxyURL.Scheme = "http"
+	return &http.Transport{
+		Proxy: http.ProxyURL(proxyURL),
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return d.DialProxy(ctx, p)
+		},
+		TLSHandshakeTimeout: v.timeout,
+		DisableKeepAlives:   true,
 	}
-	defer resp.Body.Close()
-
-	return resp.StatusCode == http.StatusOK
 }
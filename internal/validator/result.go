@@ -0,0 +1,185 @@
+package validator
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// Result holds the outcome and measurements of a single proxy validation
+type Result struct {
+	Proxy *proxy.Proxy
+	Valid bool
+	Err   error
+
+	ConnectTime  time.Duration // Time to establish the connection through the proxy
+	TLSHandshake time.Duration // TLS handshake with the target, zero for plain HTTP targets
+	TTFB         time.Duration // Time from writing the request to the first response byte
+	Throughput   float64       // Download speed in bytes per second
+}
+
+// Thresholds are admission limits for validated proxies, zero values disable a limit
+type Thresholds struct {
+	MaxConnectTime  time.Duration
+	MaxTLSHandshake time.Duration
+	MaxTTFB         time.Duration
+	MinThroughput   float64
+}
+
+func (t Thresholds) check(r *Result) error {
+	switch {
+	case t.MaxConnectTime > 0 && r.ConnectTime > t.MaxConnectTime:
+		return fmt.Errorf("connect time %s exceeds %s", r.ConnectTime, t.MaxConnectTime)
+	case t.MaxTLSHandshake > 0 && r.TLSHandshake > t.MaxTLSHandshake:
+		return fmt.Errorf("TLS handshake %s exceeds %s", r.TLSHandshake, t.MaxTLSHandshake)
+	case t.MaxTTFB > 0 && r.TTFB > t.MaxTTFB:
+		return fmt.Errorf("TTFB %s exceeds %s", r.TTFB, t.MaxTTFB)
+	case t.MinThroughput > 0 && r.Throughput < t.MinThroughput:
+		return fmt.Errorf("throughput %.0f B/s below %.0f B/s", r.Throughput, t.MinThroughput)
+	}
+	return nil
+}
+
+func (v *Validator) transportFor(p *proxy.Proxy) (*http.Transport, error) {
+	switch p.Type {
+	case proxy.HTTP:
+		return v.httpTransport(p), nil
+	case proxy.HTTPS:
+		return v.httpsTransport(p), nil
+	case proxy.SOCKS4, proxy.SOCKS5:
+		return v.socksTransport(p), nil
+	default:
+		return nil, errors.New("unsupported proxy type")
+	}
+}
+
+// measure performs a test request through the proxy and records its timings
+func (v *Validator) measure(ctx context.Context, p *proxy.Proxy) *Result {
+	result := &Result{Proxy: p}
+
+	transport, err := v.transportFor(p)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer transport.CloseIdleConnections()
+
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		conn, err := dial(ctx, network, addr)
+		result.ConnectTime = time.Since(start)
+		return conn, err
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   v.timeout,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	var tlsStart, wroteRequest, firstByte time.Time
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			if !tlsStart.IsZero() {
+				result.TLSHandshake = time.Since(tlsStart)
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "GET", v.testURL, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	for k, v := range v.testHeaders {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	if firstByte.IsZero() {
+		firstByte = time.Now()
+	}
+	if !wroteRequest.IsZero() {
+		result.TTFB = firstByte.Sub(wroteRequest)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		result.Err = fmt.Errorf("status code: %d", resp.StatusCode)
+		return result
+	}
+
+	if v.speedTestURL == "" {
+		n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxContentSize))
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		result.Throughput = throughput(n, time.Since(firstByte))
+	} else {
+		result.Throughput, err = v.speedTest(ctx, client)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+	}
+
+	result.Valid = true
+	return result
+}
+
+// speedTest downloads the configured payload and returns the observed throughput
+func (v *Validator) speedTest(ctx context.Context, client *http.Client) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", v.speedTestURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept-Encoding", "identity")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("speed test status code: %d", resp.StatusCode)
+	}
+
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, maxContentSize))
+	if err != nil {
+		return 0, err
+	}
+	return throughput(n, time.Since(start)), nil
+}
+
+func throughput(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		elapsed = time.Millisecond
+	}
+	return float64(bytes) / elapsed.Seconds()
+}
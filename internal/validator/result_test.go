@@ -0,0 +1,74 @@
+package validator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestThresholdsCheck(t *testing.T) {
+	r := &Result{ConnectTime: 100 * time.Millisecond, TLSHandshake: 200 * time.Millisecond, TTFB: 300 * time.Millisecond, Throughput: 1000}
+
+	tests := []struct {
+		name       string
+		thresholds Thresholds
+		want       string // substring of the error, empty when admitted
+	}{
+		{"disabled", Thresholds{}, ""},
+		{"within", Thresholds{MaxConnectTime: time.Second, MaxTLSHandshake: time.Second, MaxTTFB: time.Second, MinThroughput: 500}, ""},
+		{"connect", Thresholds{MaxConnectTime: 50 * time.Millisecond}, "connect time"},
+		{"tls", Thresholds{MaxTLSHandshake: 50 * time.Millisecond}, "TLS handshake"},
+		{"ttfb", Thresholds{MaxTTFB: 50 * time.Millisecond}, "TTFB"},
+		{"throughput", Thresholds{MinThroughput: 2000}, "throughput"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.thresholds.check(r)
+			if test.want == "" && err != nil || test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)) {
+				t.Errorf("check = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	// An HTTP proxy that takes delay to answer the test URL
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		time.Sleep(delay)
+		w.Write([]byte(strings.Repeat("x", 4096)))
+	}))
+	defer server.Close()
+
+	p, err := proxy.Parse(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewValidatorWithOptions(2*time.Second, time.Second, true)
+	v.SetTestURL("http://target.example/")
+	result := v.measure(context.Background(), p)
+	if !result.Valid {
+		t.Fatalf("measure failed: %v", result.Err)
+	}
+	if result.TTFB < delay || result.TTFB > time.Second {
+		t.Errorf("TTFB %s, want about %s", result.TTFB, delay)
+	}
+	if result.ConnectTime <= 0 || result.Throughput <= 0 || result.TLSHandshake != 0 {
+		t.Errorf("connect %s, throughput %.0f, TLS %s", result.ConnectTime, result.Throughput, result.TLSHandshake)
+	}
+
+	v.SetTestURL("http://target.example/down")
+	if result := v.measure(context.Background(), p); result.Valid || result.Err == nil {
+		t.Errorf("measure accepted a %d response", http.StatusBadGateway)
+	}
+}
@@ -2,59 +2,58 @@ package validator
 
 import (
 	"context"
-	"fmt"
 	"net"
 	"net/http"
+	"net/url"
 
+	"github.com/aredoff/proxygun/internal/dialer"
 	"github.com/aredoff/proxygun/internal/proxy"
-	"h12.io/socks"
 )
 
-func (v *Validator) testSOCKSProxy(p *proxy.Proxy) bool {
-	proxyAddr := net.JoinHostPort(p.Host, fmt.Sprintf("%d", p.Port))
-
-	var proxyURI string
-	switch p.Type {
-	case proxy.SOCKS4:
-		proxyURI = fmt.Sprintf("socks4://%s?timeout=%s", proxyAddr, v.timeout)
-	case proxy.SOCKS5:
-		proxyURI = fmt.Sprintf("socks5://%s?timeout=%s", proxyAddr, v.timeout)
-	default:
-		return false
-	}
-
-	dialSocksProxy := socks.Dial(proxyURI)
-	if dialSocksProxy == nil {
-		return false
-	}
-
-	transport := &http.Transport{
-		Dial:                dialSocksProxy,
+func (v *Validator) socksTransport(p *proxy.Proxy) *http.Transport {
+	d := dialer.New(v.timeout)
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return d.DialContext(ctx, p, network, addr)
+		},
 		TLSHandshakeTimeout: v.timeout,
+		DisableKeepAlives:   true,
 	}
+}
 
-	client := &http.Client{
-		Transport: transport,
-		Timeout:   v.timeout,
+// remoteDNS discovers whether a working proxy resolves destination hostnames
+// itself. HTTP and HTTPS proxies always do, a SOCKS proxy validated with the test URL
+// hostname sent remotely has proven it, and others are probed with a remote
+// resolution tunnel (SOCKS4a for SOCKS4) to the test host.
+func (v *Validator) remoteDNS(ctx context.Context, p *proxy.Proxy) bool {
+	if p.Type == proxy.HTTP || p.Type == proxy.HTTPS {
+		return true
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), v.timeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "GET", v.testURL, nil)
-	if err != nil {
-		return false
+	u, err := url.Parse(v.testURL)
+	if err != nil || net.ParseIP(u.Hostname()) != nil {
+		return false // Only a hostname tells remote resolution apart
+	}
+	if p.RemoteResolution() {
+		return true
 	}
 
-	for k, v := range v.testHeaders {
-		req.Header.Set(k, v)
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
 	}
 
-	resp, err := client.Do(req)
+	remote := *p
+	remote.Resolve = proxy.ResolveRemote
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+	conn, err := dialer.New(v.timeout).DialContext(ctx, &remote, "tcp", net.JoinHostPort(u.Hostname(), port))
 	if err != nil {
 		return false
 	}
-	defer resp.Body.Close()
-
-	return resp.StatusCode == http.StatusOK
+	conn.Close()
+	return true
 }
@@ -1,16 +1,15 @@
 package validator
 
 import (
-	"fmt"
+	"context"
+	"crypto/tls"
 	"net"
 
 	"github.com/aredoff/proxygun/internal/proxy"
 )
 
-func (v *Validator) checkTCPConnectivity(p *proxy.Proxy) bool {
-	address := net.JoinHostPort(p.Host, fmt.Sprintf("%d", p.Port))
-
-	conn, err := net.DialTimeout("tcp", address, v.tcpTimeout)
+func (v *Validator) checkTCPConnectivity(ctx context.Context, p *proxy.Proxy) bool {
+	conn, err := (&net.Dialer{Timeout: v.tcpTimeout}).DialContext(ctx, "tcp", p.String())
 	if err != nil {
 		return false
 	}
@@ -18,3 +17,18 @@ func (v *Validator) checkTCPConnectivity(p *proxy.Proxy) bool {
 
 	return true
 }
+
+// speaksTLS reports whether p completes a TLS handshake, which plain HTTP and
+// SOCKS proxies never do. The certificate is not verified, only the protocol.
+func (v *Validator) speaksTLS(ctx context.Context, p *proxy.Proxy) bool {
+	ctx, cancel := context.WithTimeout(ctx, v.tcpTimeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{Config: &tls.Config{InsecureSkipVerify: true, ServerName: p.Host}}
+	conn, err := dialer.DialContext(ctx, "tcp", p.String())
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
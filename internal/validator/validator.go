@@ -1,11 +1,16 @@
 package validator
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"time"
 
 	"github.com/aredoff/proxygun/internal/proxy"
 )
 
+var errTCPUnreachable = errors.New("proxy is not reachable over TCP")
+
 type Validator struct {
 	timeout      time.Duration
 	testURL      string
@@ -13,6 +18,14 @@ type Validator struct {
 	maxRetries   int
 	tcpTimeout   time.Duration
 	skipTCPCheck bool
+
+	contentURL    string
+	contentSHA256 string
+
+	speedTestURL string
+	thresholds   Thresholds
+
+	proxyTLS *tls.Config
 }
 
 func NewValidator() *Validator {
@@ -47,80 +60,110 @@ func NewValidatorWithOptions(timeout, tcpTimeout time.Duration, skipTCPCheck boo
 	}
 }
 
-func (v *Validator) ValidateProxy(p *proxy.Proxy) bool {
+// SetTestURL sets the URL requested through proxies during validation
+func (v *Validator) SetTestURL(url string) {
+	v.testURL = url
+}
+
+// SetTimeout sets the timeout of validation requests
+func (v *Validator) SetTimeout(timeout time.Duration) {
+	v.timeout = timeout
+}
+
+// SetSpeedTestURL sets the payload used to measure throughput. When empty,
+// throughput is measured on the test URL response body.
+func (v *Validator) SetSpeedTestURL(url string) {
+	v.speedTestURL = url
+}
+
+// SetThresholds sets the admission limits applied to validation measurements
+func (v *Validator) SetThresholds(t Thresholds) {
+	v.thresholds = t
+}
+
+// SetProxyTLS sets the TLS config used to connect to HTTPS proxies
+func (v *Validator) SetProxyTLS(config *tls.Config) {
+	v.proxyTLS = config
+}
+
+// ValidateProxy checks that p works as the proxy type it has. Cancelling ctx
+// aborts the validation.
+func (v *Validator) ValidateProxy(ctx context.Context, p *proxy.Proxy) *Result {
 	// Quick TCP connectivity check first
-	if !v.skipTCPCheck && !v.checkTCPConnectivity(p) {
-		return false
+	if !v.skipTCPCheck && !v.checkTCPConnectivity(ctx, p) {
+		return &Result{Proxy: p, Err: errTCPUnreachable}
 	}
 
-	for i := 0; i < v.maxRetries; i++ {
-		if v.testProxy(p) {
-			return true
-		}
-	}
-	return false
+	return v.validateType(ctx, p)
 }
 
-// ValidateAndDetectType validates proxy and automatically detects its type
-func (v *Validator) ValidateAndDetectType(p *proxy.Proxy) (*proxy.Proxy, bool) {
+// ValidateAndDetectType validates proxy and automatically detects its type.
+// The returned result carries a copy of the proxy with the detected type.
+func (v *Validator) ValidateAndDetectType(ctx context.Context, p *proxy.Proxy) *Result {
 	// Quick TCP connectivity check first
-	if !v.skipTCPCheck && !v.checkTCPConnectivity(p) {
-		return nil, false
+	if !v.skipTCPCheck && !v.checkTCPConnectivity(ctx, p) {
+		return &Result{Proxy: p, Err: errTCPUnreachable}
 	}
 
-	// Try HTTP first (most common)
-	if v.tryProxyType(p, proxy.HTTP) {
-		return &proxy.Proxy{
-			Host: p.Host,
-			Port: p.Port,
-			Type: proxy.HTTP,
-		}, true
+	// Skip TCP check in validateType since it's already done above
+	as := func(proxyType proxy.Type) *proxy.Proxy {
+		return &proxy.Proxy{Host: p.Host, Port: p.Port, Type: proxyType, Resolve: p.Resolve, Metadata: p.Metadata}
 	}
 
-	// Try SOCKS5
-	if v.tryProxyType(p, proxy.SOCKS5) {
-		return &proxy.Proxy{
-			Host: p.Host,
-			Port: p.Port,
-			Type: proxy.SOCKS5,
-		}, true
+	// Entries written as https:// are checked as such first. Others try HTTP
+	// (most common), SOCKS5 and SOCKS4
+	types := []proxy.Type{proxy.HTTP, proxy.SOCKS5, proxy.SOCKS4}
+	if p.Type == proxy.HTTPS {
+		types = append([]proxy.Type{proxy.HTTPS}, types...)
 	}
-
-	// Try SOCKS4 (least common, try last)
-	if v.tryProxyType(p, proxy.SOCKS4) {
-		return &proxy.Proxy{
-			Host: p.Host,
-			Port: p.Port,
-			Type: proxy.SOCKS4,
-		}, true
+	var result *Result
+	for _, proxyType := range types {
+		result = v.validateType(ctx, as(proxyType))
+		if result.Valid || ctx.Err() != nil {
+			return result
+		}
 	}
 
-	return nil, false
+	// HTTPS last, and only when the port completes a TLS handshake, so dead
+	// candidates do not pay for another round of validation retries
+	if p.Type != proxy.HTTPS && v.speaksTLS(ctx, p) {
+		return v.validateType(ctx, as(proxy.HTTPS))
+	}
+	return result
 }
 
-func (v *Validator) tryProxyType(p *proxy.Proxy, proxyType proxy.Type) bool {
-	testProxy := &proxy.Proxy{
-		Host: p.Host,
-		Port: p.Port,
-		Type: proxyType,
-	}
+// validateType validates a copy of p, recording its discovered capabilities
+// in the copy carried by the result
+func (v *Validator) validateType(ctx context.Context, p *proxy.Proxy) *Result {
+	c := *p
+	p = &c
+	p.RemoteDNS = false // Rediscovered below, SOCKS4 proxies are validated resolving locally
 
-	// Skip TCP check here since it's already done in ValidateAndDetectType
+	var result *Result
 	for i := 0; i < v.maxRetries; i++ {
-		if v.testProxy(testProxy) {
-			return true
+		result = v.measure(ctx, p)
+		if result.Valid || ctx.Err() != nil {
+			break
 		}
 	}
-	return false
-}
+	if result == nil {
+		return &Result{Proxy: p, Err: errors.New("no validation attempts")}
+	}
+	if !result.Valid {
+		return result
+	}
+
+	if err := v.thresholds.check(result); err != nil {
+		result.Valid = false
+		result.Err = err
+		return result
+	}
 
-func (v *Validator) testProxy(p *proxy.Proxy) bool {
-	switch p.Type {
-	case proxy.HTTP:
-		return v.testHTTPProxy(p)
-	case proxy.SOCKS4, proxy.SOCKS5:
-		return v.testSOCKSProxy(p)
-	default:
-		return false
+	if err := v.CheckContent(ctx, p); err != nil {
+		result.Valid = false
+		result.Err = err
+		return result
 	}
+	p.RemoteDNS = v.remoteDNS(ctx, p)
+	return result
 }
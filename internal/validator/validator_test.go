@@ -0,0 +1,111 @@
+package validator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestValidateProxyCancel(t *testing.T) {
+	// An HTTP proxy that never answers
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	p, err := proxy.Parse(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewValidatorWithOptions(10*time.Second, time.Second, true)
+	v.SetTestURL("http://target.example/")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result := v.ValidateProxy(ctx, p)
+	if result.Valid {
+		t.Fatal("a cancelled validation succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("validation took %s after cancellation", elapsed)
+	}
+}
+
+func TestValidateAndDetectType(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	secure := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	secure.Config.ErrorLog = log.New(io.Discard, "", 0) // Plain probes fail its handshakes
+	secure.StartTLS()
+	defer secure.Close()
+
+	// A port that hangs up on every client, counting TLS ClientHellos
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closed.Close()
+	var hellos atomic.Int32
+	go func() {
+		for {
+			conn, err := closed.Accept()
+			if err != nil {
+				return
+			}
+			conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			first := make([]byte, 1)
+			if n, _ := conn.Read(first); n == 1 && first[0] == 0x16 {
+				hellos.Add(1)
+			}
+			conn.Close()
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(secure.Certificate())
+	v := NewValidatorWithOptions(500*time.Millisecond, time.Second, true)
+	v.SetTestURL("http://target.example/")
+	v.SetProxyTLS(&tls.Config{RootCAs: roots})
+
+	tests := []struct {
+		addr string
+		want proxy.Type
+	}{
+		{plain.Listener.Addr().String(), proxy.HTTP},
+		{secure.Listener.Addr().String(), proxy.HTTPS},
+		{"https://" + secure.Listener.Addr().String(), proxy.HTTPS},
+	}
+	for _, test := range tests {
+		p, _ := proxy.Parse(test.addr)
+		result := v.ValidateAndDetectType(context.Background(), p)
+		if !result.Valid || result.Proxy.Type != test.want {
+			t.Errorf("%s detected as %s (valid %t, %v), want %s", test.addr, result.Proxy.Type, result.Valid, result.Err, test.want)
+		}
+	}
+
+	p, _ := proxy.Parse(closed.Addr().String())
+	if result := v.ValidateAndDetectType(context.Background(), p); result.Valid {
+		t.Fatal("a port that hangs up was detected as a proxy")
+	}
+	// One handshake probe and no HTTPS validation rounds
+	if n := hellos.Load(); n != 1 {
+		t.Errorf("%d TLS handshakes with a plain port, want the single probe", n)
+	}
+}
@@ -0,0 +1,124 @@
+package proxygun
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// override forces a request through one proxy or a direct connection
+type override struct {
+	proxy  *proxy.Proxy
+	err    error
+	direct bool
+}
+
+type overrideKey struct{}
+
+// WithProxy returns a copy of ctx whose requests through RoundTrip and
+// DialContext use the given proxy, such as "socks5://1.2.3.4:1080", instead of
+// the pool. There is a single attempt and no fallback. Stats are recorded when
+// the proxy is pooled. An unparsable proxy fails the request.
+func WithProxy(ctx context.Context, proxyURL string) context.Context {
+	p, err := proxy.Parse(proxyURL)
+	if err != nil {
+		err = fmt.Errorf("invalid proxy override %q: %w", proxyURL, err)
+	}
+	return context.WithValue(ctx, overrideKey{}, &override{proxy: p, err: err})
+}
+
+// WithDirect returns a copy of ctx whose requests through RoundTrip and
+// DialContext skip the pool and connect directly, using Config.FallbackTransport
+// when set and otherwise a transport that ignores proxy environment variables
+func WithDirect(ctx context.Context) context.Context {
+	return context.WithValue(ctx, overrideKey{}, &override{direct: true})
+}
+
+func overrideFromContext(ctx context.Context) *override {
+	o, _ := ctx.Value(overrideKey{}).(*override)
+	return o
+}
+
+// statsTarget returns the pooled entry of the override proxy for recording
+// stats, searching the default pool and then the named pools by name, or a
+// throwaway entry when no pool holds a proxy of the same type and address
+func (rt *ProxyRoundTripper) statsTarget(p *proxy.Proxy) *proxy.ProxyWithStats {
+	if pooled := rt.pool.Find(p); pooled != nil && pooled.Proxy.Type == p.Type {
+		return pooled
+	}
+	pools := rt.namedPools()
+	for _, name := range slices.Sorted(maps.Keys(pools)) {
+		if pooled := pools[name].pool.Find(p); pooled != nil && pooled.Proxy.Type == p.Type {
+			return pooled
+		}
+	}
+	return proxy.NewProxyWithStats(p)
+}
+
+// roundTripOverride sends req as forced by o. Responses with a status outside
+// Config.GoodCodes are still returned, but count as proxy failures.
+func (rt *ProxyRoundTripper) roundTripOverride(req *http.Request, o *override, config *Config) (*http.Response, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	if o.direct {
+		if err := rt.egressDirect(config); err != nil {
+			return nil, err
+		}
+		return directTransport(config).RoundTrip(req)
+	}
+	if config.StrictNoDirect && !remoteDNS(o.proxy, config) {
+		return nil, fmt.Errorf("proxy override %s: %w", o.proxy.String(), ErrDirectNotAllowed)
+	}
+
+	stats := rt.statsTarget(o.proxy)
+	start := time.Now()
+	resp, err := rt.roundTripWithProxy(req, proxy.NewProxyWithStats(o.proxy))
+	if err != nil {
+		stats.RecordFailure()
+		return nil, fmt.Errorf("proxy override %s: %w", o.proxy.String(), err)
+	}
+	if !slices.Contains(config.GoodCodes, resp.StatusCode) {
+		stats.RecordFailure()
+		return resp, nil
+	}
+	stats.RecordSuccess()
+	stats.RecordLatency(time.Since(start))
+	return resp, nil
+}
+
+// dialOverride connects to addr as forced by o
+func (rt *ProxyRoundTripper) dialOverride(ctx context.Context, o *override, network, addr string, config *Config) (net.Conn, error) {
+	if o.err != nil {
+		return nil, o.err
+	}
+	if o.direct {
+		if err := rt.egressDirect(config); err != nil {
+			return nil, err
+		}
+		return (&net.Dialer{Timeout: 30 * time.Second}).DialContext(ctx, network, addr)
+	}
+	if config.StrictNoDirect && !remoteDNS(o.proxy, config) {
+		return nil, fmt.Errorf("proxy override %s: %w", o.proxy.String(), ErrDirectNotAllowed)
+	}
+
+	stats := rt.statsTarget(o.proxy)
+	start := time.Now()
+	conn, err := rt.dialer.Load().DialContext(ctx, o.proxy.WithResolution(config.SOCKSDNS), network, addr)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		stats.RecordFailure()
+		return nil, fmt.Errorf("proxy override %s: %w", o.proxy.String(), err)
+	}
+	stats.RecordSuccess()
+	stats.RecordLatency(time.Since(start))
+	return conn, nil
+}
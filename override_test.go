@@ -0,0 +1,191 @@
+package proxygun
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestRoundTripWithProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Via", "override")
+	}))
+	defer upstream.Close()
+
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(DefaultConfig())
+	pooled, _ := proxy.Parse(upstream.Listener.Addr().String())
+	rt.pool.Add(pooled)
+	rt.pool.Add(&proxy.Proxy{Host: "10.0.0.1", Port: 8080, Type: proxy.HTTP})
+
+	req, _ := http.NewRequestWithContext(WithProxy(t.Context(), "http://"+pooled.String()), "GET", "http://example.com/", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Via") != "override" {
+		t.Fatalf("request did not go through the override proxy")
+	}
+	if stats := rt.pool.Find(pooled).StatsSnapshot(); stats.SuccessRequests != 1 {
+		t.Errorf("pooled proxy success requests %d, want 1", stats.SuccessRequests)
+	}
+
+	req, _ = http.NewRequestWithContext(WithProxy(t.Context(), "ftp://1.2.3.4:21"), "GET", "http://example.com/", nil)
+	if _, err := rt.RoundTrip(req); err == nil {
+		t.Errorf("RoundTrip with an invalid override succeeded")
+	}
+}
+
+func TestRoundTripHTTPSProxy(t *testing.T) {
+	// An HTTP proxy behind TLS, reporting the absolute URL it was asked for
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proxied", r.URL.String())
+	}))
+	defer upstream.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(upstream.Certificate())
+	config := DefaultConfig()
+	config.ProxyTLS = &tls.Config{RootCAs: roots}
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(config)
+	rt.dialer.Store(newDialer(config))
+
+	req, _ := http.NewRequestWithContext(WithProxy(t.Context(), "https://"+upstream.Listener.Addr().String()), "GET", "http://example.com/path", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Proxied"); got != "http://example.com/path" {
+		t.Errorf("proxy saw %q, want http://example.com/path", got)
+	}
+}
+
+func TestRoundTripWithDirect(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Direct", r.URL.Path)
+	}))
+	defer target.Close()
+
+	config := DefaultConfig()
+	config.FallbackTransport = nil
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(config)
+	rt.pool.Add(&proxy.Proxy{Host: "10.0.0.1", Port: 8080, Type: proxy.HTTP})
+
+	// Direct transports never pick up a proxy from the environment
+	if transport, ok := directTransport(config).(*http.Transport); !ok || transport.Proxy != nil {
+		t.Fatalf("direct transport %T uses a proxy", directTransport(config))
+	}
+
+	req, _ := http.NewRequestWithContext(WithDirect(t.Context()), "GET", target.URL+"/direct", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Direct") != "/direct" || rt.DirectConnections() != 1 {
+		t.Errorf("direct request header %q, direct connections %d", resp.Header.Get("X-Direct"), rt.DirectConnections())
+	}
+
+	strict := *config
+	strict.StrictNoDirect = true
+	rt.config.Store(&strict)
+	req, _ = http.NewRequestWithContext(WithDirect(t.Context()), "GET", target.URL, nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, ErrDirectNotAllowed) {
+		t.Errorf("strict RoundTrip error %v, want ErrDirectNotAllowed", err)
+	}
+}
+
+func TestDialContextOverrides(t *testing.T) {
+	target := newEchoServer(t)
+	upstream := newConnectProxy(t)
+
+	config := DefaultConfig()
+	config.FallbackTransport = nil
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(config)
+	rt.dialer.Store(newDialer(config))
+	pooled, _ := proxy.Parse(upstream.Listener.Addr().String())
+	rt.pool.Add(pooled)
+	rt.pool.Add(&proxy.Proxy{Host: "10.0.0.1", Port: 8080, Type: proxy.HTTP})
+
+	echo := func(ctx context.Context) error {
+		conn, err := rt.DialContext(ctx, "tcp", target.Addr().String())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.Write([]byte("ping"))
+		conn.(interface{ CloseWrite() error }).CloseWrite()
+		if got, err := io.ReadAll(conn); err != nil || string(got) != "ping" {
+			return fmt.Errorf("read %q, %v", got, err)
+		}
+		return nil
+	}
+
+	if err := echo(WithProxy(t.Context(), "http://"+pooled.String())); err != nil {
+		t.Fatalf("through the override proxy: %v", err)
+	}
+	if stats := rt.pool.Find(pooled).StatsSnapshot(); stats.SuccessRequests != 1 {
+		t.Errorf("pooled proxy success requests %d, want 1", stats.SuccessRequests)
+	}
+	if err := echo(WithDirect(t.Context())); err != nil || rt.DirectConnections() != 1 {
+		t.Fatalf("direct: %v, direct connections %d", err, rt.DirectConnections())
+	}
+
+	// A dead override proxy gets a single attempt and no fallback to the pool
+	if err := echo(WithProxy(t.Context(), "http://127.0.0.1:1")); err == nil {
+		t.Error("dial through a dead override proxy succeeded")
+	}
+	if err := echo(WithProxy(t.Context(), "ftp://1.2.3.4:21")); err == nil {
+		t.Error("dial with an invalid override succeeded")
+	}
+}
+
+func TestStatsTarget(t *testing.T) {
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(DefaultConfig())
+	paid := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.pools.Store(&map[string]*ProxyRoundTripper{"paid": paid})
+
+	rt.pool.Add(&proxy.Proxy{Host: "10.0.0.1", Port: 8080, Type: proxy.HTTP})
+	paid.pool.Add(&proxy.Proxy{Host: "10.0.0.2", Port: 1080, Type: proxy.SOCKS5})
+
+	tests := []struct {
+		override string
+		want     *pool.Pool // nil when stats go to a throwaway entry
+	}{
+		{"http://10.0.0.1:8080", rt.pool},
+		{"socks5://10.0.0.2:1080", paid.pool},
+		{"socks5h://10.0.0.2:1080", paid.pool},
+		{"socks5://10.0.0.1:8080", nil},
+		{"http://10.0.0.2:1080", nil},
+		{"http://10.0.0.3:8080", nil},
+	}
+	for _, test := range tests {
+		p, err := proxy.Parse(test.override)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := rt.statsTarget(p)
+		var want *proxy.ProxyWithStats
+		if test.want != nil {
+			want = test.want.Find(p)
+		}
+		if want != nil && got != want || want == nil && (got == rt.pool.Find(p) || got == paid.pool.Find(p)) {
+			t.Errorf("statsTarget(%s) recorded to the wrong entry", test.override)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package proxygun
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/pool"
+)
+
+// loadState restores the pool from Config.StatePath. Restored proxies are
+// usable right away and get re-validated by the health check as they idle,
+// or all at once in the background when the health check is disabled.
+func (rt *ProxyRoundTripper) loadState() {
+	config := rt.cfg()
+	data, err := os.ReadFile(config.StatePath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			config.Logger.Error().Msgf("Failed to read pool state: %v", err)
+		}
+		return
+	}
+
+	var snapshot pool.Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		config.Logger.Error().Msgf("Failed to parse pool state %s: %v", config.StatePath, err)
+		return
+	}
+
+	restored := rt.pool.Restore(&snapshot, rt.admitCandidate)
+	config.Logger.Info().Msgf("Restored %d proxies from %s saved at %s (pool: %d, free: %d)",
+		restored, config.StatePath, snapshot.SavedAt.Format(time.RFC3339), rt.pool.Size(), rt.pool.FreeSize())
+
+	// Without the health check nothing would notice proxies that died while
+	// the state was on disk until user traffic hits them
+	if restored > 0 && config.HealthCheckInterval <= 0 {
+		go func() {
+			if evicted := rt.revalidate(rt.pool.Idle(0, 0)); evicted > 0 {
+				rt.cfg().Logger.Info().Msgf("Evicted %d restored proxies that failed validation", evicted)
+			}
+		}()
+	}
+}
+
+// saveState writes the pool to Config.StatePath, replacing the file atomically
+func (rt *ProxyRoundTripper) saveState() error {
+	path := rt.cfg().StatePath
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(rt.pool.Snapshot())
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (rt *ProxyRoundTripper) stateSaveWorker(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Pick up interval changes from Reload
+			config := rt.keepWorker(&rt.stateSaving, stateSaveEnabled)
+			if config == nil {
+				return
+			}
+			ticker.Reset(config.StateSaveInterval)
+			if err := rt.saveState(); err != nil {
+				rt.cfg().Logger.Error().Msgf("Failed to save pool state: %v", err)
+			}
+		case <-rt.ctx.Done():
+			rt.keepWorker(&rt.stateSaving, stateSaveEnabled)
+			return
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package proxygun
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestLoadStateRevalidates(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, _ := proxy.Parse(l.Addr().String())
+	l.Close()
+	alive, _ := proxy.Parse(upstream.Listener.Addr().String())
+
+	config := DefaultConfig()
+	config.ValidationURL = "http://check.example/"
+	config.StatePath = filepath.Join(t.TempDir(), "state.json")
+	config.HealthCheckInterval = 0
+	newRT := func() *ProxyRoundTripper {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10), ctx: ctx, cancel: cancel}
+		rt.config.Store(config)
+		rt.validator.Store(newValidator(config))
+		return rt
+	}
+
+	saved := newRT()
+	saved.pool.Add(alive)
+	saved.pool.Add(dead)
+	if err := saved.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	// With the health check disabled the restored proxies are checked right away
+	rt := newRT()
+	rt.loadState()
+	deadline := time.Now().Add(5 * time.Second)
+	for rt.pool.Contains(dead) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rt.pool.Contains(dead) || !rt.pool.Contains(alive) {
+		t.Errorf("after loading: dead pooled %t, alive pooled %t", rt.pool.Contains(dead), rt.pool.Contains(alive))
+	}
+}
@@ -0,0 +1,122 @@
+package proxygun
+
+import (
+	"context"
+	"fmt"
+)
+
+// Reserved names of failover chain steps
+const (
+	DefaultPool = "default" // The pool configured by the top-level Config
+	DirectPool  = "direct"  // A direct connection, as with WithDirect
+)
+
+type poolChainKey struct{}
+
+// withPoolChain returns a copy of ctx whose requests try the named pools in order
+func withPoolChain(ctx context.Context, names []string) context.Context {
+	return context.WithValue(ctx, poolChainKey{}, names)
+}
+
+// chain resolves the failover chain of the request to round trippers, nil
+// standing for a direct connection. Requests without a chain use the default pool.
+func (rt *ProxyRoundTripper) chain(ctx context.Context) []*ProxyRoundTripper {
+	names, _ := ctx.Value(poolChainKey{}).([]string)
+	if len(names) == 0 {
+		return []*ProxyRoundTripper{rt}
+	}
+
+	pools := rt.namedPools()
+	chain := make([]*ProxyRoundTripper, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case DefaultPool:
+			chain = append(chain, rt)
+		case DirectPool:
+			if !rt.cfg().StrictNoDirect {
+				chain = append(chain, nil)
+			}
+		default:
+			if member := pools[name]; member != nil {
+				chain = append(chain, member)
+			}
+		}
+	}
+	return chain
+}
+
+func (rt *ProxyRoundTripper) namedPools() map[string]*ProxyRoundTripper {
+	if pools := rt.pools.Load(); pools != nil {
+		return *pools
+	}
+	return nil
+}
+
+// poolConfig returns the config of a named pool without the settings that
+// only apply to the top-level round tripper. Strict mode of the parent applies
+// to every pool.
+func poolConfig(name string, config, parent *Config) *Config {
+	c := *config
+	c.StrictNoDirect = c.StrictNoDirect || parent.StrictNoDirect
+	c.Pools = nil
+	c.Routes = nil
+	c.NoProxy = nil
+	c.FallbackTransport = nil
+	c.Logger = c.Logger.With().Str("pool", name).Logger()
+	return &c
+}
+
+// syncPools starts the named pools of config, reloads those that already run
+// and closes the ones no longer configured
+func (rt *ProxyRoundTripper) syncPools(config *Config) {
+	old := rt.namedPools()
+	pools := make(map[string]*ProxyRoundTripper, len(config.Pools))
+	for name, pc := range config.Pools {
+		if member, ok := old[name]; ok {
+			if err := member.Reload(poolConfig(name, pc, config)); err != nil {
+				config.Logger.Error().Msgf("Keeping the previous config of pool %s: %v", name, err)
+			}
+			pools[name] = member
+			continue
+		}
+		pools[name] = NewProxyRoundTripper(poolConfig(name, pc, config))
+		config.Logger.Info().Msgf("Started pool %s", name)
+	}
+	for name, member := range old {
+		if _, ok := pools[name]; !ok {
+			member.Close()
+			config.Logger.Info().Msgf("Stopped pool %s", name)
+		}
+	}
+	rt.pools.Store(&pools)
+}
+
+// validatePools checks the named pool configs and the pool names used by routes
+func validatePools(c *Config) []error {
+	var errs []error
+	for name, pc := range c.Pools {
+		switch {
+		case name == "" || name == DefaultPool || name == DirectPool:
+			errs = append(errs, fmt.Errorf("pools: %q is a reserved pool name", name))
+		case pc == nil:
+			errs = append(errs, fmt.Errorf("pools.%s: missing config", name))
+		case len(pc.Pools) > 0:
+			errs = append(errs, fmt.Errorf("pools.%s: pools cannot be nested", name))
+		default:
+			if err := pc.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("pools.%s: %w", name, err))
+			}
+			if pc.StatePath != "" && pc.StatePath == c.StatePath {
+				errs = append(errs, fmt.Errorf("pools.%s: state.path must differ from the default pool", name))
+			}
+		}
+	}
+	for i, rule := range c.Routes {
+		for _, name := range rule.Pools {
+			if _, ok := c.Pools[name]; !ok && name != DefaultPool && name != DirectPool {
+				errs = append(errs, fmt.Errorf("routes[%d]: unknown pool %q", i, name))
+			}
+		}
+	}
+	return errs
+}
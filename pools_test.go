@@ -0,0 +1,102 @@
+package proxygun
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/aredoff/proxygun/internal/parser"
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestRoundTripPoolChain(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Via", "free")
+	}))
+	defer upstream.Close()
+
+	newMember := func(config *Config) *ProxyRoundTripper {
+		member := &ProxyRoundTripper{pool: pool.NewPool(10, 10), parser: parser.NewMultiParser(nil)}
+		member.config.Store(config)
+		return member
+	}
+
+	config := DefaultConfig()
+	config.FallbackTransport = nil
+	config.Pools = map[string]*Config{"paid": DefaultConfig()}
+	config.Routes = []RouteRule{{Hosts: []string{"example.com"}, Pools: []string{"paid", DefaultPool}}}
+	rt := newMember(config)
+	r, err := newRouter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.routes.Store(r)
+	free, _ := proxy.Parse(upstream.Listener.Addr().String())
+	rt.pool.Add(free)
+
+	paid := newMember(poolConfig("paid", config.Pools["paid"], config))
+	rt.pools.Store(&map[string]*ProxyRoundTripper{"paid": paid})
+
+	// The paid pool is empty, so the request fails over to the default pool
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Via") != "free" {
+		t.Fatalf("request did not fail over to the default pool")
+	}
+
+	stats := rt.Stats()
+	if _, ok := stats["pools"].(map[string]interface{})["paid"]; !ok {
+		t.Errorf("stats of the paid pool missing: %v", stats)
+	}
+
+	config.Pools = map[string]*Config{"paid": DefaultConfig(), DirectPool: DefaultConfig()}
+	if err := config.Validate(); err == nil {
+		t.Error("reserved pool name accepted")
+	}
+}
+
+func TestNamedPoolSources(t *testing.T) {
+	sourceNames := func(config *Config) []string {
+		var names []string
+		for _, s := range buildSources(config) {
+			names = append(names, s.Name())
+		}
+		return names
+	}
+	want := []string{"File(paid-proxies.txt)"}
+
+	// The paid pool of the README scrapes its list file and nothing else
+	paid := DefaultConfig()
+	paid.Providers = []ProviderConfig{}
+	paid.SourceFiles = []string{"paid-proxies.txt"}
+	if got := sourceNames(paid); !slices.Equal(got, want) {
+		t.Errorf("paid pool sources %v, want %v", got, want)
+	}
+
+	list := writeConfig(t, "paid-proxies.txt", "1.2.3.4:8080\n")
+	path := writeConfig(t, "config.yaml", `
+pools:
+  paid:
+    pool_size: 10
+    providers: []
+    source_files: [`+list+`]
+`)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sourceNames(config.Pools["paid"]); !slices.Equal(got, want) {
+		t.Errorf("paid pool sources from the config file %v, want %v", got, want)
+	}
+
+	// Unset providers still select the built-in ones
+	if got, all := len(buildSources(config)), len(parser.DefaultParsers()); got != all {
+		t.Errorf("default pool has %d sources, want %d", got, all)
+	}
+}
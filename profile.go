@@ -0,0 +1,59 @@
+package proxygun
+
+import (
+	"context"
+	"slices"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// Profile restricts which pooled proxies serve a client of the local servers
+type Profile struct {
+	Password string      // Password a SOCKS5 client must present for this profile
+	Types    []ProxyType // Allowed upstream proxy types, empty allows all
+}
+
+func (p *Profile) matches(px *proxy.ProxyWithStats) bool {
+	return len(p.Types) == 0 || slices.Contains(p.Types, px.Proxy.Type)
+}
+
+type profileKey struct{}
+
+func withProfile(ctx context.Context, profile *Profile) context.Context {
+	return context.WithValue(ctx, profileKey{}, profile)
+}
+
+func profileFromContext(ctx context.Context) *Profile {
+	profile, _ := ctx.Value(profileKey{}).(*Profile)
+	return profile
+}
+
+// nextProxy picks the next pooled proxy allowed for the request context: by
+// the profile of a local server client and by constraints set with
+// WithConstraints. With FallbackAnyProxy the constraints are dropped when no
+// pooled proxy satisfies them. Strict mode only picks proxies resolving
+// hostnames remotely.
+func (rt *ProxyRoundTripper) nextProxy(ctx context.Context) *proxy.ProxyWithStats {
+	profile := profileFromContext(ctx)
+	constraints := constraintsFromContext(ctx)
+	config := rt.cfg()
+	strict := config.StrictNoDirect
+
+	allowed := func(px *proxy.ProxyWithStats) bool {
+		return (!strict || remoteDNS(px.Proxy, config)) && (profile == nil || profile.matches(px))
+	}
+	if constraints == nil {
+		if profile == nil && !strict {
+			return rt.pool.Next()
+		}
+		return rt.pool.NextMatching(allowed)
+	}
+
+	px := rt.pool.NextMatching(func(px *proxy.ProxyWithStats) bool {
+		return allowed(px) && constraints.matches(px)
+	})
+	if px != nil || constraints.Fallback != FallbackAnyProxy {
+		return px
+	}
+	return rt.pool.NextMatching(allowed)
+}
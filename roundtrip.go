@@ -1,6 +1,7 @@
 package proxygun
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -9,67 +10,148 @@ import (
 	"time"
 
 	"github.com/aredoff/proxygun/internal/proxy"
-	"h12.io/socks"
 )
 
 // RoundTrip implements the http.RoundTripper interface
 func (rt *ProxyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	var lastErr error
-	var proxyAttempts int
+	config := rt.cfg()
+	ctx, err := rt.route(req.Context(), req.URL.Scheme, req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	if ctx != req.Context() {
+		req = req.WithContext(ctx)
+	}
+	if o := overrideFromContext(ctx); o != nil {
+		return rt.roundTripOverride(req, o, config)
+	}
+
+	// Try the pools of the failover chain in order, queueing while they are empty
+	var tried attempts
+	wait := proxyWait{until: time.Now().Add(config.WaitForProxy)}
+	for {
+		for _, member := range rt.chain(ctx) {
+			if member == nil {
+				return rt.roundTripDirect(req, directTransport(config), &tried, config)
+			}
+			resp, err := member.roundTripProxies(req, &tried)
+			if resp != nil || err != nil {
+				return resp, err
+			}
+		}
+		if tried.count > 0 || !rt.waitForProxy(ctx, &wait) {
+			break
+		}
+	}
+
+	// If no proxies available or all proxies failed, use fallback transport
+	if config.FallbackTransport != nil && allowsDirect(ctx, config) {
+		return rt.roundTripDirect(req, config.FallbackTransport, &tried, config)
+	}
+
+	// No fallback transport configured
+	if tried.count > 0 {
+		return nil, fmt.Errorf("all %d proxy attempts failed, last error: %w", tried.count, tried.lastErr)
+	}
+	return nil, noProxyError(ctx, config)
+}
 
-	// Try with proxies first
-	for attempt := 0; attempt < rt.config.MaxRetries; attempt++ {
-		proxyWithStats := rt.pool.Next()
+// attempts tracks the proxy attempts of one request across the pools of its chain
+type attempts struct {
+	count   int
+	lastErr error
+}
+
+// roundTripProxies tries up to MaxRetries proxies of the pool. It returns
+// neither a response nor an error when every attempt failed.
+func (rt *ProxyRoundTripper) roundTripProxies(req *http.Request, tried *attempts) (*http.Response, error) {
+	config := rt.cfg()
+	for attempt := 0; attempt < config.MaxRetries; attempt++ {
+		proxyWithStats := rt.nextProxy(req.Context())
 		if proxyWithStats == nil {
 			break // No proxies available
 		}
 
-		if proxyWithStats.Stats.IsBad(MinimalRequestsToCheckBad) {
+		if proxyWithStats.IsBad(MinimalRequestsToCheckBad) {
 			rt.pool.MoveToBad(proxyWithStats.Proxy)
-			rt.config.Logger.Info().Msgf("Proxy %s is bad, moving to bad pool", proxyWithStats.Proxy.String())
+			config.Logger.Info().Msgf("Proxy %s is bad, moving to bad pool", proxyWithStats.Proxy.String())
 			attempt--
 			continue
 		}
 
-		proxyAttempts++
+		if tried.count > 0 {
+			if err := rewindBody(req); err != nil {
+				return nil, fmt.Errorf("%v after proxy error: %w", err, tried.lastErr)
+			}
+		}
+
+		tried.count++
+		start := time.Now()
 		resp, err := rt.roundTripWithProxy(req, proxyWithStats)
 		if err != nil {
 			proxyWithStats.RecordFailure()
-			lastErr = err
+			tried.lastErr = err
 			continue
 		}
 
-		if !slices.Contains(rt.config.GoodCodes, resp.StatusCode) {
+		if !slices.Contains(config.GoodCodes, resp.StatusCode) {
+			resp.Body.Close()
 			proxyWithStats.RecordFailure()
-			lastErr = fmt.Errorf("status code: %d", resp.StatusCode)
+			tried.lastErr = fmt.Errorf("status code: %d", resp.StatusCode)
 			continue
 		}
 
 		proxyWithStats.RecordSuccess()
+		proxyWithStats.RecordLatency(time.Since(start))
 		return resp, nil
 	}
+	return nil, nil
+}
+
+// roundTripDirect sends req through a direct transport after the proxy attempts
+func (rt *ProxyRoundTripper) roundTripDirect(req *http.Request, transport http.RoundTripper, tried *attempts, config *Config) (*http.Response, error) {
+	if err := rt.egressDirect(config); err != nil {
+		return nil, err
+	}
+	if tried.count > 0 {
+		if err := rewindBody(req); err != nil {
+			return nil, fmt.Errorf("%v after proxy error: %w", err, tried.lastErr)
+		}
+	}
 
-	// If no proxies available or all proxies failed, use fallback transport
-	if rt.config.FallbackTransport != nil {
-		resp, err := rt.config.FallbackTransport.RoundTrip(req)
-		if err != nil {
-			if proxyAttempts > 0 {
-				return nil, fmt.Errorf("all %d proxy attempts failed (last proxy error: %v), fallback transport also failed: %w", proxyAttempts, lastErr, err)
-			}
-			return nil, fmt.Errorf("no proxies available, fallback transport failed: %w", err)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		if tried.count > 0 {
+			return nil, fmt.Errorf("all %d proxy attempts failed (last proxy error: %v), fallback transport also failed: %w", tried.count, tried.lastErr, err)
 		}
-		return resp, nil
+		return nil, fmt.Errorf("no proxies available, fallback transport failed: %w", err)
 	}
+	return resp, nil
+}
 
-	// No fallback transport configured
-	if proxyAttempts > 0 {
-		return nil, fmt.Errorf("all %d proxy attempts failed, last error: %w", proxyAttempts, lastErr)
+// noProxyTransport is http.DefaultTransport without HTTP_PROXY and friends, so
+// direct connections do not end up at a proxy from the environment
+var noProxyTransport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	return t
+}()
+
+// directTransport returns the transport for explicitly requested direct
+// connections: the fallback transport, or noProxyTransport when it is disabled
+func directTransport(config *Config) http.RoundTripper {
+	if config.FallbackTransport != nil {
+		return config.FallbackTransport
 	}
-	return nil, errors.New("no proxies available and no fallback transport configured")
+	return noProxyTransport
 }
 
+// roundTripWithProxy sends req through one proxy. Every request gets its own
+// transport, so keep-alives are disabled: idle connections to proxies would
+// otherwise outlive the transport and pile up.
 func (rt *ProxyRoundTripper) roundTripWithProxy(req *http.Request, proxyWithStats *proxy.ProxyWithStats) (*http.Response, error) {
-	p := proxyWithStats.Proxy
+	p := proxyWithStats.Proxy.WithResolution(rt.cfg().SOCKSDNS)
+	d := rt.dialer.Load()
 
 	var transport *http.Transport
 
@@ -81,30 +163,49 @@ func (rt *ProxyRoundTripper) roundTripWithProxy(req *http.Request, proxyWithStat
 				Timeout: 30 * time.Second,
 			}).DialContext,
 			TLSHandshakeTimeout: 10 * time.Second,
+			DisableKeepAlives:   true,
 		}
-	case proxy.SOCKS4, proxy.SOCKS5:
-		proxyAddr := net.JoinHostPort(p.Host, fmt.Sprintf("%d", p.Port))
-
-		var proxyURI string
-		switch p.Type {
-		case proxy.SOCKS4:
-			proxyURI = fmt.Sprintf("socks4://%s?timeout=30s", proxyAddr)
-		case proxy.SOCKS5:
-			proxyURI = fmt.Sprintf("socks5://%s?timeout=30s", proxyAddr)
-		}
-
-		dialSocksProxy := socks.Dial(proxyURI)
-		if dialSocksProxy == nil {
-			return nil, errors.New("failed to create SOCKS proxy dialer")
+	case proxy.HTTPS:
+		// The transport speaks plain HTTP to the proxy over a TLS connection
+		// dialed here, keeping the proxy TLS settings apart from the destination's
+		proxyURL := p.URL()
+		proxyURL.Scheme = "http"
+		transport = &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return d.DialProxy(ctx, p)
+			},
+			TLSHandshakeTimeout: 10 * time.Second,
+			DisableKeepAlives:   true,
 		}
-
+	case proxy.SOCKS4, proxy.SOCKS5:
 		transport = &http.Transport{
-			Dial:                dialSocksProxy,
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return d.DialContext(ctx, p, network, addr)
+			},
 			TLSHandshakeTimeout: 10 * time.Second,
+			DisableKeepAlives:   true,
 		}
 	default:
 		return nil, errors.New("unsupported proxy type")
 	}
 
+	defer transport.CloseIdleConnections()
 	return transport.RoundTrip(req)
 }
+
+// rewindBody restores the request body consumed by a previous attempt
+func rewindBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.GetBody == nil {
+		return errors.New("request body cannot be replayed for retry")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
@@ -0,0 +1,95 @@
+package proxygun
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+	"github.com/rs/zerolog"
+)
+
+// waitGoroutines fails the test unless the goroutine count drops back to
+// about baseline, as it does once every connection is closed
+func waitGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline+5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left, %d before the requests", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRoundTripReleasesConnections(t *testing.T) {
+	// An HTTP proxy failing /bad, an HTTPS proxy, and a SOCKS5 proxy
+	// connecting directly
+	httpProxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer httpProxy.Close()
+	httpsProxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer httpsProxy.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(httpsProxy.Certificate())
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+
+	socksConfig := DefaultConfig()
+	socksConfig.Logger = zerolog.Nop()
+	socksRT := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	socksRT.config.Store(socksConfig)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socksServer := NewSOCKS5Server(socksRT)
+	go socksServer.Serve(l)
+	defer socksServer.Close()
+
+	tests := []struct {
+		name  string
+		proxy string
+		url   string
+	}{
+		{"http", httpProxy.Listener.Addr().String(), "http://example.com/"},
+		{"http bad status", httpProxy.Listener.Addr().String(), "http://example.com/bad"},
+		{"https", "https://" + httpsProxy.Listener.Addr().String(), "http://example.com/"},
+		{"socks5", "socks5://" + l.Addr().String(), target.URL},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.FallbackTransport = nil
+			config.Logger = zerolog.Nop()
+			config.ProxyTLS = &tls.Config{RootCAs: roots}
+			rt := &ProxyRoundTripper{}
+			rt.config.Store(config)
+			rt.dialer.Store(newDialer(config))
+			p, _ := proxy.Parse(test.proxy)
+
+			baseline := runtime.NumGoroutine()
+			for range 30 {
+				// A fresh pool so failures do not ban the proxy
+				rt.pool = pool.NewPool(10, 10)
+				rt.pool.Add(p)
+				req, _ := http.NewRequest("GET", test.url, nil)
+				if resp, err := rt.RoundTrip(req); err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			}
+			waitGoroutines(t, baseline)
+		})
+	}
+}
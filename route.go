@@ -0,0 +1,258 @@
+package proxygun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrRouteRejected is returned for requests matching a RouteReject rule
+var ErrRouteRejected = errors.New("request rejected by routing rule")
+
+// RouteAction is what a routing rule does with the requests it matches
+type RouteAction int
+
+const (
+	RoutePool         RouteAction = iota // Use the pool and never connect directly
+	RoutePoolFallback                    // Use the pool and fall back to Config.FallbackTransport
+	RouteDirect                          // Skip the pool and connect directly
+	RouteReject                          // Fail with ErrRouteRejected
+)
+
+func (a RouteAction) String() string {
+	switch a {
+	case RoutePool:
+		return "pool"
+	case RoutePoolFallback:
+		return "pool_fallback"
+	case RouteDirect:
+		return "direct"
+	case RouteReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+func (a RouteAction) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *RouteAction) UnmarshalText(text []byte) error {
+	for _, action := range []RouteAction{RoutePool, RoutePoolFallback, RouteDirect, RouteReject} {
+		if strings.EqualFold(string(text), action.String()) {
+			*a = action
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown route action %q, use pool, pool_fallback, direct or reject", text)
+}
+
+// RouteRule sends the requests it matches to an action. Every non-empty
+// criterion must match; a destination matches when it fits any entry of Hosts
+// or CIDRs. Schemes never match raw dials and CONNECT tunnels, whose protocol
+// is unknown.
+type RouteRule struct {
+	Hosts   []string // Exact names, globs such as "*.example.com", or ".example.com" for the domain and its subdomains
+	CIDRs   []string // Networks of IP literal destinations
+	Schemes []string // Request URL schemes, e.g. "http" or "https"
+	Ports   []int    // Destination ports
+	Action  RouteAction
+
+	// Failover chain for RoutePool and RoutePoolFallback: names of
+	// Config.Pools, DefaultPool or DirectPool, tried in order. Empty uses the
+	// default pool.
+	Pools []string
+
+	// Proxies used by RoutePool and RoutePoolFallback, unless the request
+	// carries its own constraints. Fallback is ignored except FallbackAnyProxy.
+	Constraints Constraints
+}
+
+// router is the compiled form of Config.NoProxy and Config.Routes
+type router struct {
+	rules    []RouteRule
+	prefixes [][]netip.Prefix // Parsed CIDRs of each rule
+}
+
+func newRouter(config *Config) (*router, error) {
+	r := &router{}
+	var errs []error
+	for _, entry := range config.NoProxy {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		rule, err := noProxyRule(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("no_proxy: %w", err))
+			continue
+		}
+		r.add(rule, &errs)
+	}
+	for i, rule := range config.Routes {
+		if rule.Action < RoutePool || rule.Action > RouteReject {
+			errs = append(errs, fmt.Errorf("routes[%d]: unknown action %d", i, rule.Action))
+		}
+		r.add(rule, &errs)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return r, nil
+}
+
+func (r *router) add(rule RouteRule, errs *[]error) {
+	prefixes := make([]netip.Prefix, 0, len(rule.CIDRs))
+	for _, cidr := range rule.CIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			*errs = append(*errs, fmt.Errorf("routes: %w", err))
+			continue
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	for _, pattern := range rule.Hosts {
+		if _, err := path.Match(pattern, ""); err != nil {
+			*errs = append(*errs, fmt.Errorf("routes: bad host pattern %q", pattern))
+		}
+	}
+	r.rules = append(r.rules, rule)
+	r.prefixes = append(r.prefixes, prefixes)
+}
+
+// noProxyRule turns a NO_PROXY entry into a direct rule: "*", a domain matching
+// itself and its subdomains (with or without a leading dot), an IP, or a CIDR,
+// each optionally followed by ":port"
+func noProxyRule(entry string) (RouteRule, error) {
+	rule := RouteRule{Action: RouteDirect}
+	if entry == "*" {
+		rule.Hosts = []string{"*"}
+		return rule, nil
+	}
+
+	if _, err := netip.ParsePrefix(entry); err == nil {
+		rule.CIDRs = []string{entry}
+		return rule, nil
+	}
+	host := entry
+	if h, port, err := net.SplitHostPort(entry); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return rule, fmt.Errorf("invalid port in %q", entry)
+		}
+		host, rule.Ports = h, []int{p}
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		rule.CIDRs = []string{netip.PrefixFrom(addr, addr.BitLen()).String()}
+		return rule, nil
+	}
+	rule.Hosts = []string{"." + strings.TrimPrefix(strings.TrimPrefix(host, "*"), ".")}
+	return rule, nil
+}
+
+// match returns the first rule matching the destination, or nil
+func (r *router) match(scheme, host string, port int) *RouteRule {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	addr, addrErr := netip.ParseAddr(host)
+
+	for i := range r.rules {
+		rule := &r.rules[i]
+		if len(rule.Schemes) > 0 && !slices.ContainsFunc(rule.Schemes, func(s string) bool { return strings.EqualFold(s, scheme) }) {
+			continue
+		}
+		if len(rule.Ports) > 0 && !slices.Contains(rule.Ports, port) {
+			continue
+		}
+		if len(rule.Hosts) == 0 && len(r.prefixes[i]) == 0 {
+			return rule
+		}
+		if slices.ContainsFunc(rule.Hosts, func(pattern string) bool { return matchHost(pattern, host) }) {
+			return rule
+		}
+		if addrErr == nil && slices.ContainsFunc(r.prefixes[i], func(prefix netip.Prefix) bool { return prefix.Contains(addr.Unmap()) }) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func matchHost(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	if domain, ok := strings.CutPrefix(pattern, "."); ok {
+		return host == domain || strings.HasSuffix(host, pattern)
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		ok, _ := path.Match(pattern, host)
+		return ok
+	}
+	return host == pattern
+}
+
+type noDirectKey struct{}
+
+// route applies the routing rule matching the destination to the request
+// context. Explicit WithProxy and WithDirect overrides take precedence over
+// direct and pool rules, and constraints set by the caller over those of the rule.
+func (rt *ProxyRoundTripper) route(ctx context.Context, scheme, hostport string) (context.Context, error) {
+	r := rt.routes.Load()
+	if r == nil || len(r.rules) == 0 {
+		return ctx, nil
+	}
+
+	host, port := splitDestination(scheme, hostport)
+	rule := r.match(scheme, host, port)
+	if rule == nil {
+		return ctx, nil
+	}
+
+	switch rule.Action {
+	case RouteReject:
+		return nil, fmt.Errorf("%w: %s", ErrRouteRejected, hostport)
+	case RouteDirect:
+		if overrideFromContext(ctx) == nil {
+			ctx = WithDirect(ctx)
+		}
+		return ctx, nil
+	}
+
+	if constraintsFromContext(ctx) == nil {
+		// The action decides about direct connections, not the fallback policy
+		constraints := rule.Constraints
+		if constraints.Fallback != FallbackAnyProxy {
+			constraints.Fallback = FallbackDefault
+		}
+		ctx = WithConstraints(ctx, constraints)
+	}
+	if len(rule.Pools) > 0 {
+		ctx = withPoolChain(ctx, rule.Pools)
+	}
+	if rule.Action == RoutePool {
+		ctx = context.WithValue(ctx, noDirectKey{}, true)
+	}
+	return ctx, nil
+}
+
+// splitDestination returns the host and port of hostport, defaulting the
+// port from the scheme
+func splitDestination(scheme, hostport string) (string, int) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = strings.Trim(hostport, "[]")
+		switch strings.ToLower(scheme) {
+		case "https":
+			return host, 443
+		case "http":
+			return host, 80
+		}
+		return host, 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
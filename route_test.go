@@ -0,0 +1,113 @@
+package proxygun
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aredoff/proxygun/internal/pool"
+)
+
+func TestRouterMatch(t *testing.T) {
+	r, err := newRouter(&Config{
+		NoProxy: []string{"localhost", ".corp.example", "10.0.0.0/8", "db.example.com:5432"},
+		Routes: []RouteRule{
+			{Hosts: []string{"*.bank.example"}, Schemes: []string{"https"}, Action: RoutePool},
+			{CIDRs: []string{"192.168.0.0/16"}, Action: RouteReject},
+			{Ports: []int{25}, Action: RouteReject},
+			{Hosts: []string{"example.org"}, Action: RoutePoolFallback},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		scheme, hostport string
+		want             RouteAction
+		matched          bool
+	}{
+		{"http", "localhost:8080", RouteDirect, true},
+		{"https", "git.corp.example", RouteDirect, true},
+		{"https", "corp.example", RouteDirect, true},
+		{"http", "10.1.2.3", RouteDirect, true},
+		{"", "db.example.com:5432", RouteDirect, true},
+		{"", "db.example.com:3306", 0, false},
+		{"https", "www.bank.example", RoutePool, true},
+		{"http", "www.bank.example", 0, false},
+		{"http", "192.168.1.1:80", RouteReject, true},
+		{"", "mail.example.com:25", RouteReject, true},
+		{"https", "EXAMPLE.ORG", RoutePoolFallback, true},
+		{"https", "example.com", 0, false},
+	}
+	for _, test := range tests {
+		host, port := splitDestination(test.scheme, test.hostport)
+		rule := r.match(test.scheme, host, port)
+		if (rule != nil) != test.matched || (rule != nil && rule.Action != test.want) {
+			t.Errorf("%s %s: got %v, want action %s matched=%t", test.scheme, test.hostport, rule, test.want, test.matched)
+		}
+	}
+
+	if _, err := newRouter(&Config{Routes: []RouteRule{{CIDRs: []string{"not a cidr"}}}}); err == nil {
+		t.Error("invalid CIDR accepted")
+	}
+}
+
+func TestRoundTripRoutes(t *testing.T) {
+	config := DefaultConfig()
+	config.Routes = []RouteRule{
+		{Hosts: []string{"blocked.example"}, Action: RouteReject},
+		{Hosts: []string{"paid.example"}, Action: RoutePool},
+	}
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(config)
+	r, err := newRouter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.routes.Store(r)
+
+	req, _ := http.NewRequest("GET", "http://blocked.example/", nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, ErrRouteRejected) {
+		t.Errorf("rejected route error %v, want ErrRouteRejected", err)
+	}
+
+	// The pool is empty and the rule forbids falling back to a direct connection
+	if _, err := rt.DialContext(context.Background(), "tcp", "paid.example:443"); !errors.Is(err, ErrNoProxyAvailable) {
+		t.Errorf("pool-only route error %v, want ErrNoProxyAvailable", err)
+	}
+}
+
+func TestRouteFallbackPolicy(t *testing.T) {
+	config := DefaultConfig()
+	config.Routes = []RouteRule{
+		{Hosts: []string{"any.example"}, Action: RoutePoolFallback, Constraints: Constraints{Countries: []string{"DE"}, Fallback: FallbackAnyProxy}},
+		{Hosts: []string{"fail.example"}, Action: RoutePoolFallback, Constraints: Constraints{Countries: []string{"DE"}, Fallback: FallbackFail}},
+	}
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(config)
+	r, err := newRouter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.routes.Store(r)
+
+	// Only FallbackAnyProxy of a rule is kept, the action decides about going direct
+	tests := []struct {
+		host string
+		want FallbackPolicy
+	}{
+		{"any.example", FallbackAnyProxy},
+		{"fail.example", FallbackDefault},
+	}
+	for _, test := range tests {
+		ctx, err := rt.route(context.Background(), "https", test.host+":443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := constraintsFromContext(ctx); m == nil || m.Fallback != test.want {
+			t.Errorf("route to %s set constraints %+v, want fallback %v", test.host, m, test.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package proxygun
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxReplayBody is the largest request body buffered for retries
+const maxReplayBody = 1 << 20
+
+// hopHeaders are connection-specific headers that must not be forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ProxyServer is a local HTTP proxy that sends every request and CONNECT
+// tunnel through the rotating pool of a ProxyRoundTripper
+type ProxyServer struct {
+	rt     *ProxyRoundTripper
+	server *http.Server
+}
+
+// NewProxyServer creates a forward proxy front-end for rt
+func NewProxyServer(rt *ProxyRoundTripper) *ProxyServer {
+	return &ProxyServer{rt: rt}
+}
+
+// ListenAndServe listens on addr and serves proxy requests until Shutdown
+func (s *ProxyServer) ListenAndServe(addr string) error {
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+	return s.server.ListenAndServe()
+}
+
+// Shutdown gracefully stops a server started with ListenAndServe
+func (s *ProxyServer) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
+
+// ServeHTTP implements the http.Handler interface
+func (s *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		s.serveConnect(w, r)
+		return
+	}
+
+	if !r.URL.IsAbs() {
+		http.Error(w, "proxy requests must use an absolute URI", http.StatusBadRequest)
+		return
+	}
+
+	s.serveForward(w, r)
+}
+
+func (s *ProxyServer) serveForward(w http.ResponseWriter, r *http.Request) {
+	outReq := r.Clone(r.Context())
+	outReq.RequestURI = ""
+	removeHopHeaders(outReq.Header)
+
+	// Buffer small bodies so the request can be retried through another proxy
+	if r.ContentLength > 0 && r.ContentLength <= maxReplayBody {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		outReq.Body = io.NopCloser(bytes.NewReader(body))
+		outReq.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	resp, err := s.rt.RoundTrip(outReq)
+	if err != nil {
+		s.rt.cfg().Logger.Error().Msgf("Proxy server request to %s failed: %v", r.URL.Host, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func (s *ProxyServer) serveConnect(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunnelling is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	upstream, err := s.rt.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		s.rt.cfg().Logger.Error().Msgf("Proxy server tunnel to %s failed: %v", r.Host, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+
+	// Bytes the client sent right after the CONNECT request
+	if n := buffered.Reader.Buffered(); n > 0 {
+		data, _ := buffered.Reader.Peek(n)
+		if _, err := upstream.Write(data); err != nil {
+			client.Close()
+			upstream.Close()
+			return
+		}
+	}
+
+	pipe(client, upstream)
+}
+
+// pipe copies data in both directions until either side is done
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyConn := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	go copyConn(a, b)
+	go copyConn(b, a)
+	wg.Wait()
+	a.Close()
+	b.Close()
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, field := range strings.Split(h.Get("Connection"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			h.Del(field)
+		}
+	}
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+}
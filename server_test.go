@@ -0,0 +1,138 @@
+package proxygun
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+// newConnectProxy starts an HTTP proxy answering CONNECT that passes
+// half-closes on in both directions
+func newConnectProxy(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		pipe(conn, upstream)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newEchoServer starts a TCP server that reads until the client half-closes,
+// then sends the data back
+func newEchoServer(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				data, _ := io.ReadAll(conn)
+				conn.Write(data)
+			}()
+		}
+	}()
+	return l
+}
+
+func TestProxyServerConnect(t *testing.T) {
+	target := newEchoServer(t)
+	upstream := newConnectProxy(t)
+
+	config := DefaultConfig()
+	config.FallbackTransport = nil
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(config)
+	rt.dialer.Store(newDialer(config))
+	pooled, _ := proxy.Parse(upstream.Listener.Addr().String())
+	rt.pool.Add(pooled)
+
+	server := httptest.NewServer(NewProxyServer(rt))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	addr := target.Addr().String()
+	conn.Write([]byte("CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT answered %s", resp.Status)
+	}
+
+	// The echo only arrives if the half-close reaches the target through both proxies
+	conn.Write([]byte("ping"))
+	conn.(*net.TCPConn).CloseWrite()
+	if got, err := io.ReadAll(reader); err != nil || string(got) != "ping" {
+		t.Errorf("read %q, %v through the tunnel, want ping", got, err)
+	}
+	if stats := rt.pool.Find(pooled).StatsSnapshot(); stats.SuccessRequests != 1 {
+		t.Errorf("pooled proxy success requests %d, want 1", stats.SuccessRequests)
+	}
+}
+
+func TestDialContextFallback(t *testing.T) {
+	target := newEchoServer(t)
+
+	tests := []struct {
+		name      string
+		transport http.RoundTripper
+		dials     bool
+	}{
+		{"default", http.DefaultTransport, true},
+		{"direct", &http.Transport{}, true},
+		{"disabled", nil, false},
+		{"proxied", &http.Transport{Proxy: http.ProxyURL(nil)}, false},
+		{"custom dialer", &http.Transport{DialContext: (&net.Dialer{}).DialContext}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.FallbackTransport = test.transport
+			rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+			rt.config.Store(config)
+
+			conn, err := rt.DialContext(t.Context(), "tcp", target.Addr().String())
+			if conn != nil {
+				conn.Close()
+			}
+			if dialed := err == nil; dialed != test.dials {
+				t.Errorf("dialed directly %t (%v), want %t", dialed, err, test.dials)
+			}
+		})
+	}
+}
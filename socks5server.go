@@ -0,0 +1,271 @@
+package proxygun
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SOCKS5 protocol constants (RFC 1928, RFC 1929)
+const (
+	socks5Version      = 5
+	socks5AuthVersion  = 1
+	socks5NoAuth       = 0
+	socks5UserPassAuth = 2
+	socks5NoAcceptable = 0xff
+	socks5CmdConnect   = 1
+	socks5AddrIPv4     = 1
+	socks5AddrDomain   = 3
+	socks5AddrIPv6     = 4
+
+	socks5Succeeded          = 0
+	socks5HostUnreachable    = 4
+	socks5CmdNotSupported    = 7
+	socks5AddrTypeNotSupport = 8
+)
+
+// SOCKS5Server is a local SOCKS5 proxy that chains every CONNECT through
+// the rotating pool of a ProxyRoundTripper
+type SOCKS5Server struct {
+	// Profiles maps usernames to pool profiles. When empty, clients connect
+	// without authentication and may use any pooled proxy.
+	Profiles map[string]Profile
+
+	rt       *ProxyRoundTripper
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// NewSOCKS5Server creates a SOCKS5 front-end for rt
+func NewSOCKS5Server(rt *ProxyRoundTripper) *SOCKS5Server {
+	return &SOCKS5Server{rt: rt}
+}
+
+// ListenAndServe listens on addr and serves SOCKS5 clients until Close
+func (s *SOCKS5Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts SOCKS5 clients on l until Close
+func (s *SOCKS5Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting new clients, open tunnels finish on their own
+func (s *SOCKS5Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *SOCKS5Server) serveConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	profile, err := s.negotiate(reader, conn)
+	if err != nil {
+		s.rt.cfg().Logger.Debug().Msgf("SOCKS5 handshake with %s failed: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	addr, err := s.readRequest(reader, conn)
+	if err != nil {
+		s.rt.cfg().Logger.Debug().Msgf("SOCKS5 request from %s failed: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	ctx := context.Background()
+	if profile != nil {
+		ctx = withProfile(ctx, profile)
+	}
+
+	upstream, err := s.rt.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		s.rt.cfg().Logger.Error().Msgf("SOCKS5 tunnel to %s failed: %v", addr, err)
+		writeSOCKS5Reply(conn, socks5HostUnreachable)
+		conn.Close()
+		return
+	}
+
+	if err := writeSOCKS5Reply(conn, socks5Succeeded); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	// Bytes the client pipelined after its request
+	if n := reader.Buffered(); n > 0 {
+		data, _ := reader.Peek(n)
+		if _, err := upstream.Write(data); err != nil {
+			conn.Close()
+			upstream.Close()
+			return
+		}
+	}
+
+	pipe(conn, upstream)
+}
+
+// negotiate performs method selection and optional username/password
+// authentication, returning the profile of the authenticated user
+func (s *SOCKS5Server) negotiate(r *bufio.Reader, w io.Writer) (*Profile, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[0] != socks5Version {
+		return nil, fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return nil, err
+	}
+
+	method := byte(socks5NoAuth)
+	if len(s.Profiles) > 0 {
+		method = socks5UserPassAuth
+	}
+
+	accepted := false
+	for _, m := range methods {
+		if m == method {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		w.Write([]byte{socks5Version, socks5NoAcceptable})
+		return nil, errors.New("no acceptable authentication method")
+	}
+	if _, err := w.Write([]byte{socks5Version, method}); err != nil {
+		return nil, err
+	}
+
+	if method == socks5NoAuth {
+		return nil, nil
+	}
+
+	// Username/password sub-negotiation
+	version, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != socks5AuthVersion {
+		return nil, fmt.Errorf("unsupported auth version %d", version)
+	}
+	username, err := readSOCKS5String(r)
+	if err != nil {
+		return nil, err
+	}
+	password, err := readSOCKS5String(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Passwords are compared in constant time so response timing does not leak them
+	profile, ok := s.Profiles[username]
+	if !ok || subtle.ConstantTimeCompare([]byte(profile.Password), []byte(password)) != 1 {
+		w.Write([]byte{socks5AuthVersion, 1})
+		return nil, fmt.Errorf("authentication failed for user %q", username)
+	}
+	if _, err := w.Write([]byte{socks5AuthVersion, 0}); err != nil {
+		return nil, err
+	}
+	return &profile, nil
+}
+
+// readRequest reads a CONNECT request and returns the target address
+func (s *SOCKS5Server) readRequest(r *bufio.Reader, w io.Writer) (string, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return "", err
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	if header[1] != socks5CmdConnect {
+		writeSOCKS5Reply(w, socks5CmdNotSupported)
+		return "", fmt.Errorf("unsupported command %d", header[1])
+	}
+
+	var host string
+	switch header[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		size := net.IPv4len
+		if header[3] == socks5AddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = net.IP(ip).String()
+	case socks5AddrDomain:
+		domain, err := readSOCKS5String(r)
+		if err != nil {
+			return "", err
+		}
+		host = domain
+	default:
+		writeSOCKS5Reply(w, socks5AddrTypeNotSupport)
+		return "", fmt.Errorf("unsupported address type %d", header[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+func readSOCKS5String(r *bufio.Reader) (string, error) {
+	size, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// writeSOCKS5Reply sends a reply with an unspecified bound address
+func writeSOCKS5Reply(w io.Writer, code byte) error {
+	_, err := w.Write([]byte{socks5Version, code, 0, socks5AddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
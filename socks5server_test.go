@@ -0,0 +1,102 @@
+package proxygun
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+	xproxy "golang.org/x/net/proxy"
+)
+
+func TestSOCKS5ServerConnect(t *testing.T) {
+	target := newEchoServer(t)
+	upstream := newConnectProxy(t)
+
+	config := DefaultConfig()
+	config.FallbackTransport = nil
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(config)
+	rt.dialer.Store(newDialer(config))
+	pooled, _ := proxy.Parse(upstream.Listener.Addr().String())
+	rt.pool.Add(pooled)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewSOCKS5Server(rt)
+	server.Profiles = map[string]Profile{"alice": {Password: "secret"}}
+	go server.Serve(l)
+	defer server.Close()
+
+	dial := func(auth *xproxy.Auth, addr string) (net.Conn, error) {
+		client, err := xproxy.SOCKS5("tcp", l.Addr().String(), auth, xproxy.Direct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client.Dial("tcp", addr)
+	}
+
+	if _, err := dial(&xproxy.Auth{User: "alice", Password: "wrong"}, target.Addr().String()); err == nil {
+		t.Error("a wrong password was accepted")
+	}
+	if _, err := dial(nil, target.Addr().String()); err == nil {
+		t.Error("a client without credentials was accepted")
+	}
+
+	// Port 1 of a name in the domain address type is never reachable
+	if _, err := dial(&xproxy.Auth{User: "alice", Password: "secret"}, "localhost:1"); err == nil {
+		t.Error("a tunnel to a closed port succeeded")
+	}
+
+	conn, err := dial(&xproxy.Auth{User: "alice", Password: "secret"}, target.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("ping"))
+	conn.(*net.TCPConn).CloseWrite()
+	if got, err := io.ReadAll(conn); err != nil || string(got) != "ping" {
+		t.Errorf("read %q, %v through the tunnel, want ping", got, err)
+	}
+}
+
+func TestSOCKS5ReadRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		request []byte
+		want    string // empty when the request is rejected
+		reply   byte   // reply code sent on rejection, 0 when none
+	}{
+		{"ipv4", []byte{5, 1, 0, 1, 10, 0, 0, 1, 0, 80}, "10.0.0.1:80", 0},
+		{"ipv6", append(append([]byte{5, 1, 0, 4}, net.ParseIP("2001:db8::1")...), 1, 187), "[2001:db8::1]:443", 0},
+		{"domain", append([]byte{5, 1, 0, 3, 11}, append([]byte("example.com"), 0x1f, 0x90)...), "example.com:8080", 0},
+		{"version", []byte{4, 1, 0, 1, 10, 0, 0, 1, 0, 80}, "", 0},
+		{"bind", []byte{5, 2, 0, 1, 10, 0, 0, 1, 0, 80}, "", socks5CmdNotSupported},
+		{"address type", []byte{5, 1, 0, 9, 0, 80}, "", socks5AddrTypeNotSupport},
+		{"truncated", []byte{5, 1, 0, 1, 10, 0}, "", 0},
+	}
+	s := &SOCKS5Server{}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var reply bytes.Buffer
+			addr, err := s.readRequest(bufio.NewReader(bytes.NewReader(test.request)), &reply)
+			if test.want != "" {
+				if err != nil || addr != test.want {
+					t.Fatalf("got %q, %v, want %s", addr, err, test.want)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("accepted %q", addr)
+			}
+			if test.reply != 0 && (reply.Len() < 2 || reply.Bytes()[1] != test.reply) {
+				t.Errorf("reply %v, want code %d", reply.Bytes(), test.reply)
+			}
+		})
+	}
+}
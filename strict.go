@@ -0,0 +1,116 @@
+package proxygun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+var (
+	// ErrNoProxyAvailable is returned when no pooled proxy can serve a request
+	// and it may not go direct
+	ErrNoProxyAvailable = errors.New("no proxies available")
+
+	// ErrDirectNotAllowed is returned for direct connections asked for in strict mode
+	ErrDirectNotAllowed = errors.New("direct connections are not allowed in strict mode")
+)
+
+// waitPollInterval is how often a request queued by Config.WaitForProxy
+// looks for a usable proxy
+const waitPollInterval = 100 * time.Millisecond
+
+// egressDirect is the gate of every direct connection: it refuses them in
+// strict mode and counts them otherwise
+func (rt *ProxyRoundTripper) egressDirect(config *Config) error {
+	if config.StrictNoDirect {
+		return ErrDirectNotAllowed
+	}
+	rt.directConnections.Add(1)
+	return nil
+}
+
+// DirectConnections returns how many connections bypassed the proxies so far,
+// through the fallback transport, direct routes or WithDirect. It stays zero
+// in strict mode.
+func (rt *ProxyRoundTripper) DirectConnections() int64 {
+	return rt.directConnections.Load()
+}
+
+// remoteDNS reports whether the proxy resolves destination hostnames itself
+// under the configured resolution
+func remoteDNS(p *proxy.Proxy, config *Config) bool {
+	return p.WithResolution(config.SOCKSDNS).RemoteResolution()
+}
+
+// proxyWait is the state of a request queueing for a proxy
+type proxyWait struct {
+	until  time.Time
+	topped bool // Pools of the chain were asked for proxies
+}
+
+// waitForProxy queues a request that found no usable proxy until the next
+// poll. The first poll asks the pools of the chain that are short of proxies
+// for a top-up; providers are scraped on their schedules rather than forced.
+// It returns false once the wait is over or ctx is done.
+func (rt *ProxyRoundTripper) waitForProxy(ctx context.Context, wait *proxyWait) bool {
+	remaining := time.Until(wait.until)
+	if remaining <= 0 {
+		return false
+	}
+	if !wait.topped {
+		wait.topped = true
+		for _, member := range rt.chain(ctx) {
+			if member != nil && member.pool.NeedsProxies() > 0 {
+				member.topUp()
+			}
+		}
+	}
+
+	timer := time.NewTimer(min(remaining, waitPollInterval))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// noProxyError explains why a request that made no proxy attempt failed
+func noProxyError(ctx context.Context, config *Config) error {
+	if m := constraintsFromContext(ctx); m != nil && m.Fallback == FallbackFail {
+		return ErrNoMatchingProxy
+	}
+	switch {
+	case config.WaitForProxy > 0:
+		return fmt.Errorf("%w after waiting %s", ErrNoProxyAvailable, config.WaitForProxy)
+	case config.StrictNoDirect || config.FallbackTransport != nil:
+		return ErrNoProxyAvailable
+	}
+	return fmt.Errorf("%w and no fallback transport configured", ErrNoProxyAvailable)
+}
+
+// validateStrict checks that no setting asks for direct connections in strict mode
+func validateStrict(c *Config) []error {
+	if !c.StrictNoDirect {
+		return nil
+	}
+	var errs []error
+	if len(c.NoProxy) > 0 {
+		errs = append(errs, errors.New("strict_no_direct: no_proxy would connect directly"))
+	}
+	for i, rule := range c.Routes {
+		if rule.Action == RouteDirect {
+			errs = append(errs, fmt.Errorf("strict_no_direct: routes[%d] connects directly", i))
+		}
+		for _, name := range rule.Pools {
+			if name == DirectPool {
+				errs = append(errs, fmt.Errorf("strict_no_direct: routes[%d] fails over to a direct connection", i))
+			}
+		}
+	}
+	return errs
+}
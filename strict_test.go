@@ -0,0 +1,101 @@
+package proxygun
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aredoff/proxygun/internal/pool"
+	"github.com/aredoff/proxygun/internal/proxy"
+)
+
+func TestStrictNoDirect(t *testing.T) {
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer direct.Close()
+
+	config := DefaultConfig()
+	config.StrictNoDirect = true
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10)}
+	rt.config.Store(config)
+
+	// SOCKS4 resolves hostnames locally and is never selected in strict mode
+	rt.pool.Add(&proxy.Proxy{Host: "127.0.0.1", Port: 1, Type: proxy.SOCKS4})
+
+	req, _ := http.NewRequest("GET", direct.URL, nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, ErrNoProxyAvailable) {
+		t.Errorf("RoundTrip error %v, want ErrNoProxyAvailable", err)
+	}
+	req, _ = http.NewRequestWithContext(WithDirect(context.Background()), "GET", direct.URL, nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, ErrDirectNotAllowed) {
+		t.Errorf("WithDirect error %v, want ErrDirectNotAllowed", err)
+	}
+	if _, err := rt.DialContext(context.Background(), "tcp", direct.Listener.Addr().String()); !errors.Is(err, ErrNoProxyAvailable) {
+		t.Errorf("DialContext error %v, want ErrNoProxyAvailable", err)
+	}
+	if n := rt.DirectConnections(); n != 0 {
+		t.Errorf("%d direct connections in strict mode", n)
+	}
+
+	config.NoProxy = []string{"localhost"}
+	if err := config.Validate(); err == nil {
+		t.Error("no_proxy accepted in strict mode")
+	}
+}
+
+func TestWaitForProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	config := DefaultConfig()
+	config.StrictNoDirect = true
+	config.WaitForProxy = 2 * time.Second
+	rt := &ProxyRoundTripper{pool: pool.NewPool(10, 10), topUpCh: make(chan struct{}, 1)}
+	rt.config.Store(config)
+
+	// The request queues until a proxy joins the pool, asking for a top-up as it starts waiting
+	go func() {
+		<-rt.topUpCh
+		p, _ := proxy.Parse(upstream.Listener.Addr().String())
+		rt.pool.Add(p)
+	}()
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestWaitForProxyTopUp(t *testing.T) {
+	config := DefaultConfig()
+	config.StrictNoDirect = true
+	config.WaitForProxy = 350 * time.Millisecond
+
+	// Room for every request the pools get, so none is dropped or coalesced
+	newMember := func(config *Config) *ProxyRoundTripper {
+		member := &ProxyRoundTripper{
+			pool:      pool.NewPool(10, 10),
+			refreshCh: make(chan struct{}, 10),
+			topUpCh:   make(chan struct{}, 10),
+		}
+		member.config.Store(config)
+		return member
+	}
+	rt := newMember(config)
+	paid := newMember(config)
+	rt.pools.Store(&map[string]*ProxyRoundTripper{"paid": paid})
+
+	// The request polls several times before giving up
+	req, _ := http.NewRequestWithContext(withPoolChain(t.Context(), []string{"paid", DefaultPool}), "GET", "http://example.com/", nil)
+	if _, err := rt.RoundTrip(req); !errors.Is(err, ErrNoProxyAvailable) {
+		t.Fatalf("RoundTrip error %v, want ErrNoProxyAvailable", err)
+	}
+	for name, member := range map[string]*ProxyRoundTripper{DefaultPool: rt, "paid": paid} {
+		if len(member.topUpCh) != 1 || len(member.refreshCh) != 0 {
+			t.Errorf("pool %s got %d top-ups and %d forced refreshes, want one top-up", name, len(member.topUpCh), len(member.refreshCh))
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package proxygun
 
 import (
+	"context"
 	"sync"
 
 	"github.com/aredoff/proxygun/internal/proxy"
@@ -44,15 +45,15 @@ import (
 // 	return validProxies
 // }
 
-func ValidateProxiesConcurrentStream(v *validator.Validator, proxies []*proxy.Proxy, workers int, validChan chan<- *proxy.Proxy) {
+// ValidateProxiesConcurrentStream validates proxies with a worker pool and sends
+// the results of those that passed to validChan. Candidates are handed to workers
+// one at a time, so cancelling ctx stops the pipeline without dialing the rest.
+func ValidateProxiesConcurrentStream(ctx context.Context, v *validator.Validator, proxies []*proxy.Proxy, workers int, validChan chan<- *validator.Result) {
 	if workers <= 0 {
 		workers = 10
 	}
-	if workers > 50 {
-		workers = 50
-	}
 
-	jobs := make(chan *proxy.Proxy, len(proxies))
+	jobs := make(chan *proxy.Proxy)
 	var wg sync.WaitGroup
 
 	for w := 0; w < workers; w++ {
@@ -60,15 +61,26 @@ func ValidateProxiesConcurrentStream(v *validator.Validator, proxies []*proxy.Pr
 		go func() {
 			defer wg.Done()
 			for p := range jobs {
-				if v.ValidateProxy(p) {
-					validChan <- p
+				result := v.ValidateProxy(ctx, p)
+				if !result.Valid {
+					continue
+				}
+				select {
+				case validChan <- result:
+				case <-ctx.Done():
+					return
 				}
 			}
 		}()
 	}
 
+feed:
 	for _, p := range proxies {
-		jobs <- p
+		select {
+		case jobs <- p:
+		case <-ctx.Done():
+			break feed
+		}
 	}
 	close(jobs)
 